@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+func add(repo *internal.Repository, args []string) error {
+	flags := flag.NewFlagSet("add", flag.ContinueOnError)
+	msg := flags.String("m", "", "commit message, generated from the changes when not given")
+	allowEmpty := flags.Bool("allow-empty", false, "commit even when nothing changed")
+	trigger := flags.String("trigger", os.Getenv("GIMINI_TRIGGER"),
+		"what started the snapshot, told in the generated message, $GIMINI_TRIGGER or manual by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: gimini add [-m <message>] [-allow-empty] [-trigger <trigger>] <path>")
+	}
+
+	path, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	w, err := internal.GetWorktree(repo)
+	if err != nil {
+		return err
+	}
+
+	w.SetAllowEmpty(*allowEmpty)
+	w.SetTrigger(internal.Trigger(*trigger))
+
+	if err := w.PreAdd([]string{path}); err != nil {
+		return err
+	}
+
+	// Add dir
+	hash, err := w.Add(path)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+
+	return commit(&w, *msg)
+}
+
+// commit commits the staged changes, printing the commit, its tree and the
+// status left, then the report. The message is generated when empty. Nothing
+// is committed when nothing changed, unless the worktree allows it.
+func commit(w *internal.Worktree, msg string) error {
+	hash, err := w.Commit(msg, &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "gimini",
+			Email: "gimini@acme.com",
+			When:  time.Now(),
+		},
+	})
+	if err == internal.ErrEmptyCommit {
+		fmt.Println(err)
+		printExcluded(w.Report())
+		return printReport(w.Report())
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+
+	// Get commit
+	commit, err := object.GetCommit(w.Repo().Storer, hash)
+	if err != nil {
+		return err
+	}
+	fmt.Println(commit)
+
+	// Get tree
+	tree, err := object.GetTree(w.Repo().Storer, commit.TreeHash)
+	if err != nil {
+		return err
+	}
+	fmt.Println(tree)
+
+	// Print status
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+	fmt.Println(status)
+	printExcluded(w.Report())
+
+	return printReport(w.Report())
+}
+
+// printExcluded lists the files left out of the snapshot on purpose, along
+// with the status.
+func printExcluded(r *internal.Report) {
+	var paths []string
+	for path := range r.Excluded {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		fmt.Printf("excluded: %s %s\n", r.Excluded[path], path)
+	}
+}
+
+// printReport writes the warnings and errors of the report to stderr, and
+// returns errPartial when some paths could not be read.
+func printReport(r *internal.Report) error {
+	for _, warning := range r.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+
+	for _, err := range r.Errors {
+		fmt.Fprintln(os.Stderr, "error:", err)
+	}
+
+	if r.Partial() {
+		return errPartial
+	}
+
+	return nil
+}
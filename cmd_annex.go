@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"flag"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+// get fetches the annexed content of files from the remote store.
+func get(repo *internal.Repository, args []string) error {
+	commit, paths, err := annexArgs(repo, "get", args)
+	if err != nil {
+		return err
+	}
+
+	return repo.AnnexGet(commit, paths...)
+}
+
+// drop frees the local copies of the annexed content of files.
+func drop(repo *internal.Repository, args []string) error {
+	commit, paths, err := annexArgs(repo, "drop", args)
+	if err != nil {
+		return err
+	}
+
+	return repo.AnnexDrop(commit, paths...)
+}
+
+func annexArgs(repo *internal.Repository, name string, args []string) (plumbing.Hash, []string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	rev := flags.String("commit", "HEAD", "commit whose files are considered")
+	if err := flags.Parse(args); err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	if flags.NArg() == 0 {
+		return plumbing.ZeroHash, nil, errors.New("usage: gimini " + name + " [-commit <commit>] <path>...")
+	}
+
+	commit, err := repo.ResolveCommit(*rev)
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	paths, err := absPaths(flags.Args())
+	return commit, paths, err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+// checkReport is the report check writes as JSON.
+type checkReport struct {
+	Commit string           `json:"commit"`
+	Drift  []internal.Drift `json:"drift"`
+	Errors []string         `json:"errors,omitempty"`
+}
+
+// check compares the system with a snapshot.
+func check(repo *internal.Repository, args []string) error {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "write the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() < 1 {
+		return errors.New("usage: gimini check [-json] <commit> [path...]")
+	}
+
+	commit, err := repo.ResolveCommit(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	paths, err := absPaths(flags.Args()[1:])
+	if err != nil {
+		return err
+	}
+
+	w, err := internal.GetWorktree(repo)
+	if err != nil {
+		return err
+	}
+
+	drift, err := w.Check(commit, paths...)
+	if err != nil {
+		return err
+	}
+
+	report := checkReport{Commit: commit.String(), Drift: drift}
+	for _, err := range w.Report().Errors {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range drift {
+			if d.Expected != "" || d.Actual != "" {
+				fmt.Printf("%s %s: %s -> %s\n", d.Kind, d.Path, d.Expected, d.Actual)
+			} else {
+				fmt.Printf("%s %s\n", d.Kind, d.Path)
+			}
+		}
+
+		for _, err := range report.Errors {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+	}
+
+	if len(drift) != 0 {
+		return errDrift
+	}
+
+	if len(report.Errors) != 0 {
+		return errPartial
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type CheckSuite struct{}
+
+var _ = Suite(&CheckSuite{})
+
+func (s *CheckSuite) TestCheckDrift(c *C) {
+	home, set := os.LookupEnv("HOME")
+	defer func() {
+		if set {
+			os.Setenv("HOME", home)
+		} else {
+			os.Unsetenv("HOME")
+		}
+	}()
+	c.Assert(os.Setenv("HOME", c.MkDir()), IsNil)
+
+	repo, err := internal.OpenOrInit()
+	c.Assert(err, IsNil)
+
+	dir := c.MkDir()
+	file := filepath.Join(dir, "file")
+	c.Assert(ioutil.WriteFile(file, []byte("foo"), 0644), IsNil)
+	c.Assert(add(repo, []string{dir}), IsNil)
+
+	c.Assert(check(repo, []string{"HEAD", dir}), IsNil)
+
+	c.Assert(ioutil.WriteFile(file, []byte("bar"), 0644), IsNil)
+	err = check(repo, []string{"HEAD", dir})
+	c.Assert(err, Equals, errDrift)
+	c.Assert(exitCodes[err], Equals, 4)
+}
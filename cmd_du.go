@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+// du reports the space the tracked paths take in a snapshot, or the new data
+// they added over a range of snapshots.
+func du(repo *internal.Repository, args []string) error {
+	flags := flag.NewFlagSet("du", flag.ContinueOnError)
+	depth := flags.Int("depth", 1, "directory levels reported below the tracked paths")
+	since := flags.String("since", "", "report the growth since the date, as 2006-01-02 or RFC 3339")
+	until := flags.String("until", "", "end the growth report at the date, a day included, now by default")
+	top := flags.Int("top", 20, "number of paths in the growth report, all when 0")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *since != "" {
+		if flags.NArg() != 0 {
+			return errors.New("usage: gimini du -since <date> [-until <date>] [-depth <n>] [-top <n>]")
+		}
+
+		return growth(repo, *since, *until, *depth, *top)
+	}
+
+	if flags.NArg() > 1 || *until != "" {
+		return errors.New("usage: gimini du [-depth <n>] [<commit>]")
+	}
+
+	rev := "HEAD"
+	if flags.NArg() == 1 {
+		rev = flags.Arg(0)
+	}
+
+	commit, err := repo.ResolveCommit(rev)
+	if err != nil {
+		return err
+	}
+
+	usage, err := repo.DiskUsage(commit, *depth)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%10s %10s  %s\n", "unique", "shared", "path")
+	for _, u := range usage {
+		fmt.Printf("%10s %10s  %s\n", formatSize(u.Unique), formatSize(u.Shared), u.Path)
+	}
+
+	return nil
+}
+
+func growth(repo *internal.Repository, since, until string, depth, top int) error {
+	from, err := parseDate(since)
+	if err != nil {
+		return err
+	}
+
+	to := time.Now()
+	if until != "" {
+		if to, err = parseEndDate(until); err != nil {
+			return err
+		}
+	}
+
+	growth, err := repo.GrowthBetween(from, to, depth)
+	if err != nil {
+		return err
+	}
+
+	if top > 0 && len(growth) > top {
+		growth = growth[:top]
+	}
+
+	fmt.Printf("%10s %8s  %s\n", "added", "files", "path")
+	for _, g := range growth {
+		fmt.Printf("%10s %8d  %s\n", formatSize(g.Size), g.Files, g.Path)
+	}
+
+	return nil
+}
+
+// parseDate parses a date, in local time when no zone is given.
+func parseDate(s string) (time.Time, error) {
+	t, _, err := parseDay(s)
+	return t, err
+}
+
+// parseEndDate parses a date like parseDate, a day without a time standing
+// for its end.
+func parseEndDate(s string) (time.Time, error) {
+	t, day, err := parseDay(s)
+	if err != nil || !day {
+		return t, err
+	}
+
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+// parseDay parses a date, day telling it had no time.
+func parseDay(s string) (t time.Time, day bool, err error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+
+	t, err = time.ParseInLocation("2006-01-02", s, time.Local)
+	return t, true, err
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+// gc deletes the unreachable objects and repacks the others.
+func gc(repo *internal.Repository, args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	dryRun := flags.Bool("n", false, "only count what would be deleted")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return errors.New("usage: gimini gc [-n]")
+	}
+
+	res, err := repo.GC(*dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "removed"
+	if *dryRun {
+		verb = "would remove"
+	}
+
+	fmt.Printf("%s %d objects and %d annexed files, %s\n", verb, res.Objects, res.Annexed, formatSize(res.Size))
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+// prune removes the snapshots the keep policy expires.
+func prune(repo *internal.Repository, args []string) error {
+	policy := repo.KeepPolicy()
+
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	flags.IntVar(&policy.Hourly, "keep-hourly", policy.Hourly, "number of hourly snapshots to keep")
+	flags.IntVar(&policy.Daily, "keep-daily", policy.Daily, "number of daily snapshots to keep")
+	flags.IntVar(&policy.Weekly, "keep-weekly", policy.Weekly, "number of weekly snapshots to keep")
+	flags.IntVar(&policy.Monthly, "keep-monthly", policy.Monthly, "number of monthly snapshots to keep")
+	flags.IntVar(&policy.Yearly, "keep-yearly", policy.Yearly, "number of yearly snapshots to keep")
+	dryRun := flags.Bool("n", false, "only list what would be removed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return errors.New("usage: gimini prune [-n] [-keep-hourly <n>] [-keep-daily <n>] [-keep-weekly <n>] [-keep-monthly <n>] [-keep-yearly <n>]")
+	}
+
+	res, err := repo.Prune(policy, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "removed"
+	if *dryRun {
+		verb = "would remove"
+	}
+
+	for branch, commits := range res.Removed {
+		for _, c := range commits {
+			fmt.Printf("%s %s %s %s\n", verb, branch, c.Hash, c.Committer.When.Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	fmt.Printf("%s %d objects and %d annexed files, %s\n", verb, res.Objects, res.Annexed, formatSize(res.Size))
+	return nil
+}
+
+// formatSize returns the size in bytes in a human readable unit.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
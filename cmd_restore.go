@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+// restore writes the files stored in a commit back to the system, all of
+// them or only the ones below the given paths.
+func restore(repo *internal.Repository, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: gimini restore <commit> [path...]")
+	}
+
+	commit, err := repo.ResolveCommit(args[0])
+	if err != nil {
+		return err
+	}
+
+	paths, err := absPaths(args[1:])
+	if err != nil {
+		return err
+	}
+
+	w, err := internal.GetWorktree(repo)
+	if err != nil {
+		return err
+	}
+
+	if err := w.Restore(commit, paths...); err != nil {
+		return err
+	}
+
+	return printReport(w.Report())
+}
+
+func absPaths(paths []string) ([]string, error) {
+	abs := make([]string, len(paths))
+	for i, path := range paths {
+		var err error
+		if abs[i], err = filepath.Abs(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return abs, nil
+}
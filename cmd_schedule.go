@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+// runScheduled snapshots the tracked paths which are due given their
+// schedule, once or as a daemon.
+func runScheduled(repo *internal.Repository, args []string) error {
+	flags := flag.NewFlagSet("run-scheduled", flag.ContinueOnError)
+	daemon := flags.Bool("daemon", false, "keep running, snapshotting the paths as they are due")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return errors.New("usage: gimini run-scheduled [-daemon]")
+	}
+
+	if !*daemon {
+		return runDue(repo)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		// A partial snapshot is reported, the next run may read the rest
+		if err := runDue(repo); err != nil && err != errPartial {
+			return err
+		}
+
+		next, ok, err := repo.NextRun()
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return errors.New("no tracked path has a schedule")
+		}
+
+		select {
+		case <-time.After(time.Until(next)):
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+// runDue snapshots the paths which are due in a single commit, and records
+// they were run.
+func runDue(repo *internal.Repository) error {
+	now := time.Now()
+
+	paths, err := repo.DuePaths(now)
+	if err != nil {
+		return err
+	}
+
+	if len(paths) == 0 {
+		fmt.Println("no path is due")
+		return nil
+	}
+
+	w, err := internal.GetWorktree(repo)
+	if err != nil {
+		return err
+	}
+
+	w.SetTrigger(internal.TriggerCron)
+
+	if err := w.PreAdd(paths); err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		fmt.Println("snapshotting", p)
+		if _, err := w.Add(p); err != nil {
+			return err
+		}
+	}
+
+	err = commit(&w, "")
+	if err != nil && err != errPartial {
+		return err
+	}
+
+	if err := repo.MarkRun(paths, now); err != nil {
+		return err
+	}
+
+	return err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+// find lists the files whose path matches a glob across the snapshots.
+func find(repo *internal.Repository, args []string) error {
+	var opts internal.SearchOptions
+
+	flags := flag.NewFlagSet("find", flag.ContinueOnError)
+	flags.IntVar(&opts.MaxCommits, "max-commits", 0, "number of snapshots searched, the newest first, all when 0")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() < 1 {
+		return errors.New("usage: gimini find [-max-commits <n>] <glob> [path...]")
+	}
+
+	paths, err := absPaths(flags.Args()[1:])
+	if err != nil {
+		return err
+	}
+	opts.Paths = paths
+
+	return repo.Find(flags.Arg(0), opts, func(m internal.Match) error {
+		fmt.Printf("%s %s %s\n", m.Commit.Hash, m.Commit.Committer.When.Format("2006-01-02 15:04:05"), m.Path)
+		return nil
+	})
+}
+
+// grep lists the lines of the files matching a regular expression across
+// the snapshots.
+func grep(repo *internal.Repository, args []string) error {
+	var opts internal.SearchOptions
+
+	flags := flag.NewFlagSet("grep", flag.ContinueOnError)
+	flags.IntVar(&opts.MaxCommits, "max-commits", 0, "number of snapshots searched, the newest first, all when 0")
+	flags.BoolVar(&opts.Binary, "binary", false, "search binary files too")
+	ignoreCase := flags.Bool("i", false, "ignore case")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() < 1 {
+		return errors.New("usage: gimini grep [-i] [-binary] [-max-commits <n>] <pattern> [path...]")
+	}
+
+	pattern := flags.Arg(0)
+	if *ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	paths, err := absPaths(flags.Args()[1:])
+	if err != nil {
+		return err
+	}
+	opts.Paths = paths
+
+	return repo.Grep(re, opts, func(m internal.Match) error {
+		fmt.Printf("%s %s %s:%d:%s\n", m.Commit.Hash, m.Commit.Committer.When.Format("2006-01-02 15:04:05"), m.Path, m.Line, m.Text)
+		return nil
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+// show writes the content of a file as stored in a commit to stdout.
+func show(repo *internal.Repository, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: gimini show <commit> <path>")
+	}
+
+	commit, err := repo.ResolveCommit(args[0])
+	if err != nil {
+		return err
+	}
+
+	// The sidecar, holding the output of the commands, is never below a
+	// tracked path so that its paths are left as they are
+	path := args[1]
+	if !strings.HasPrefix(path, ".gimini/") {
+		if path, err = filepath.Abs(path); err != nil {
+			return err
+		}
+	}
+
+	return repo.Show(commit, path, os.Stdout)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+// tag marks a snapshot with a name usable wherever a commit is, or lists
+// the tags when no name is given.
+func tag(repo *internal.Repository, args []string) error {
+	flags := flag.NewFlagSet("tag", flag.ContinueOnError)
+	msg := flags.String("m", "", "message of the tag, its name by default")
+	del := flags.Bool("d", false, "delete the tag")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case flags.NArg() == 0 && !*del:
+		tags, err := repo.ListTags()
+		if err != nil {
+			return err
+		}
+
+		for _, t := range tags {
+			msg := strings.SplitN(t.Message, "\n", 2)[0]
+			fmt.Printf("%s %s %s %s\n", t.Name, t.Commit, t.When.Format("2006-01-02 15:04:05"), msg)
+		}
+
+		return nil
+
+	case flags.NArg() == 1 && *del:
+		return repo.DeleteTag(flags.Arg(0))
+
+	case !*del && (flags.NArg() == 1 || flags.NArg() == 2):
+		rev := "HEAD"
+		if flags.NArg() == 2 {
+			rev = flags.Arg(1)
+		}
+
+		commit, err := repo.ResolveCommit(rev)
+		if err != nil {
+			return err
+		}
+
+		return repo.CreateTag(flags.Arg(0), commit, *msg)
+	}
+
+	return errors.New("usage: gimini tag [-m <message>] <name> [<commit>] | gimini tag -d <name> | gimini tag")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+// verify checks the objects of the repository are present and intact.
+func verify(repo *internal.Repository, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	percent := flags.Float64("sample", 100, "percentage of the blobs whose content is checked")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 || *percent < 0 || *percent > 100 {
+		return errors.New("usage: gimini verify [-sample <percent>]")
+	}
+
+	res, err := repo.Verify(*percent)
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range res.Problems {
+		fmt.Println(problem)
+	}
+
+	fmt.Printf("checked %d commits, %d trees and %d blobs\n", res.Commits, res.Trees, res.Blobs)
+	if len(res.Problems) != 0 {
+		return fmt.Errorf("found %d problems", len(res.Problems))
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/WhoMeNope/gimini/internal"
+)
+
+// watch snapshots the tracked paths as they change, until interrupted.
+func watch(repo *internal.Repository, args []string) error {
+	policy := repo.WatchPolicy()
+
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	flags.DurationVar(&policy.Quiet, "quiet", policy.Quiet, "time without changes before committing")
+	flags.DurationVar(&policy.MaxInterval, "max-interval", policy.MaxInterval, "longest time changes wait to be committed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return errors.New("usage: gimini watch [-quiet <duration>] [-max-interval <duration>]")
+	}
+
+	w, err := internal.GetWorktree(repo)
+	if err != nil {
+		return err
+	}
+
+	w.SetTrigger(internal.TriggerWatch)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	return w.Watch(policy, func(w *internal.Worktree) error {
+		// A partial snapshot is reported, the next changes may be readable
+		if err := commit(w, ""); err != nil && err != errPartial {
+			return err
+		}
+
+		fmt.Println()
+		return nil
+	}, stop)
+}
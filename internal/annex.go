@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"github.com/WhoMeNope/gimini/internal/utils/annex"
+)
+
+// openAnnexed returns a reader of annexed content, from the local store if
+// it holds it or else from the remote one.
+func (r *Repository) openAnnexed(p *annex.Pointer) (io.ReadCloser, error) {
+	if r.annex.Has(p.Key) {
+		return r.annex.Open(p.Key)
+	}
+
+	remote := r.annexRemote()
+	if remote == nil || !remote.Has(p.Key) {
+		return nil, fmt.Errorf("annexed content %s is not present, no store holds it", p.Key)
+	}
+
+	return remote.Open(p.Key)
+}
+
+// AnnexGet fetches the annexed content of the files of the commit at or below
+// the given paths from the remote store into the local one.
+func (r *Repository) AnnexGet(commit plumbing.Hash, paths ...string) error {
+	remote := r.annexRemote()
+
+	return r.walkAnnexed(commit, paths, func(path string, p *annex.Pointer) error {
+		if r.annex.Has(p.Key) {
+			return nil
+		}
+
+		if remote == nil || !remote.Has(p.Key) {
+			return fmt.Errorf("%s: annexed content %s is not present in any store", path, p.Key)
+		}
+
+		return r.annex.Copy(remote, p.Key)
+	})
+}
+
+// AnnexDrop frees the local copies of the annexed content of the files of the
+// commit at or below the given paths. Content is only dropped once the copy
+// of the remote store is verified, missing or corrupt copies being uploaded
+// again first.
+func (r *Repository) AnnexDrop(commit plumbing.Hash, paths ...string) error {
+	remote := r.annexRemote()
+	if remote == nil {
+		return fmt.Errorf("no annex_remote configured, dropping would lose content")
+	}
+
+	return r.walkAnnexed(commit, paths, func(path string, p *annex.Pointer) error {
+		if !r.annex.Has(p.Key) {
+			return nil
+		}
+
+		if err := remote.Verify(p.Key); err != nil {
+			if err := remote.Remove(p.Key); err != nil {
+				return fmt.Errorf("%s: cannot remove corrupt content from remote: %s", path, err)
+			}
+
+			if err := remote.Copy(r.annex, p.Key); err != nil {
+				return fmt.Errorf("%s: cannot copy content to remote: %s", path, err)
+			}
+
+			if err := remote.Verify(p.Key); err != nil {
+				return fmt.Errorf("%s: content on remote does not verify, kept locally: %s", path, err)
+			}
+		}
+
+		return r.annex.Remove(p.Key)
+	})
+}
+
+// walkAnnexed calls fn with the pointer of every annexed file of the commit at
+// or below the given paths.
+func (r *Repository) walkAnnexed(commit plumbing.Hash, paths []string, fn func(path string, p *annex.Pointer) error) error {
+	return r.walkFiles(commit, paths, func(path string, entry object.TreeEntry) error {
+		if !entry.Mode.IsFile() {
+			return nil
+		}
+
+		p, err := r.readPointer(entry.Hash)
+		if err != nil || p == nil {
+			return err
+		}
+
+		return fn(path, p)
+	})
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/WhoMeNope/gimini/internal/utils/annex"
+)
+
+type AnnexSuite struct {
+	homeFixture
+}
+
+var _ = Suite(&AnnexSuite{})
+
+func (s *AnnexSuite) TestAnnexDropTruncatedRemote(c *C) {
+	w, dir := newTestWorktree(c)
+
+	w.repo.config.AnnexRemote = c.MkDir()
+	w.repo.config.Paths = append(w.repo.config.Paths, pathConfig{Path: dir, AnnexThreshold: 1})
+
+	file := filepath.Join(dir, "file")
+	c.Assert(ioutil.WriteFile(file, []byte("foo"), 0644), IsNil)
+	commit := snapshot(c, w, dir)
+
+	p, err := annex.NewPointer(bytes.NewReader([]byte("foo")))
+	c.Assert(err, IsNil)
+
+	// the remote copy is cut short, by an interrupted upload
+	remote := filepath.Join(w.repo.config.AnnexRemote, p.Key[:2], p.Key[2:])
+	c.Assert(os.Truncate(remote, 1), IsNil)
+
+	c.Assert(w.repo.AnnexDrop(commit), IsNil)
+	c.Assert(w.repo.annex.Has(p.Key), Equals, false)
+	c.Assert(w.repo.annexRemote().Verify(p.Key), IsNil)
+
+	c.Assert(os.Remove(file), IsNil)
+	c.Assert(w.Restore(commit, file), IsNil)
+
+	data, err := ioutil.ReadFile(file)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "foo")
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"bufio"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+
+	"github.com/WhoMeNope/gimini/internal/utils/annex"
+	"github.com/WhoMeNope/gimini/internal/utils/chunker"
+)
+
+// openBlob returns a reader of the content of the file stored in the blob
+// with the given hash, reassembling it from its chunks when the blob is a
+// manifest and reading it from the annex when the blob is a pointer.
+func (r *Repository) openBlob(h plumbing.Hash) (io.ReadCloser, error) {
+	m, p, err := r.decodeBlob(h)
+	switch {
+	case err != nil:
+		return nil, err
+	case m != nil:
+		return chunker.NewReader(r.Storer, m), nil
+	case p != nil:
+		return r.openAnnexed(p)
+	}
+
+	obj, err := r.Storer.EncodedObject(plumbing.BlobObject, h)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.Reader()
+}
+
+// readPointer returns the annex pointer stored in the blob with the given
+// hash, nil if the blob is not a pointer.
+func (r *Repository) readPointer(h plumbing.Hash) (*annex.Pointer, error) {
+	_, p, err := r.decodeBlob(h)
+	return p, err
+}
+
+// decodeBlob returns the manifest or the annex pointer stored in the blob
+// with the given hash, both nil when the blob is the content of the file.
+func (r *Repository) decodeBlob(h plumbing.Hash) (m *chunker.Manifest, p *annex.Pointer, err error) {
+	obj, err := r.Storer.EncodedObject(plumbing.BlobObject, h)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	src, err := obj.Reader()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer ioutil.CheckClose(src, &err)
+
+	br := bufio.NewReader(src)
+	head, _ := br.Peek(len(chunker.Magic))
+	switch {
+	case chunker.IsManifest(head):
+		m = &chunker.Manifest{}
+		if err := m.Decode(br); err != nil {
+			return nil, nil, err
+		}
+	case annex.IsPointer(head):
+		p = &annex.Pointer{}
+		if err := p.Decode(br); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return m, p, nil
+}
+
+// storeBlob writes data as a blob and returns its hash.
+func (r *Repository) storeBlob(data []byte) (plumbing.Hash, error) {
+	obj := r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+
+	writer, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return r.setBlob(obj, "")
+}
@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/utils/merkletrie"
+)
+
+// Drift is a difference between a snapshot and the system.
+type Drift struct {
+	Path string `json:"path"`
+	// Kind is what differs: added, missing, content, mode, owner, device
+	// or xattrs.
+	Kind     string `json:"kind"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// Check compares the system with the snapshot of the commit, at or below the
+// given paths, and returns the differences sorted by path. Unlike the status,
+// the index plays no part. The content is compared the way status does, the
+// permissions, ownership and extended attributes against the metadata
+// recorded in the commit.
+func (w *Worktree) Check(commit plumbing.Hash, paths ...string) ([]Drift, error) {
+	c, err := w.repo.CommitObject(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := merkletrie.DiffTree(
+		object.NewTreeRootNode(tree),
+		w.repo.config.getFilesystemNode(w.systemFilesystem, func(name string, err error) {
+			w.report.fail(systemPath(name), err)
+		}),
+		diffTreeIsEquals,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []Drift
+	for _, ch := range changes {
+		a, err := ch.Action()
+		if err != nil {
+			return nil, err
+		}
+
+		name := nameFromAction(&ch)
+		if isSidecar(name) || !isBelowAny(systemPath(name), paths) {
+			continue
+		}
+
+		d := Drift{Path: systemPath(name)}
+		switch a {
+		case merkletrie.Delete:
+			d.Kind = "missing"
+		case merkletrie.Insert:
+			d.Kind = "added"
+		case merkletrie.Modify:
+			d.Kind = "content"
+		}
+
+		drift = append(drift, d)
+	}
+
+	m, err := w.repo.commitMetadata(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, fm := range m {
+		path := systemPath(name)
+		if !isBelowAny(path, paths) {
+			continue
+		}
+
+		fi, err := w.lstat(path)
+		if err != nil {
+			// missing files are reported by the diff of the content
+			if fm.isMetadataOnly() {
+				drift = append(drift, Drift{Path: path, Kind: "missing"})
+			}
+
+			continue
+		}
+
+		current, err := newFileMetadata(path, fi)
+		if err != nil {
+			return nil, err
+		}
+
+		drift = append(drift, diffFileMetadata(path, fm, current)...)
+	}
+
+	sort.SliceStable(drift, func(i, j int) bool {
+		return drift[i].Path < drift[j].Path
+	})
+
+	return drift, nil
+}
+
+// diffFileMetadata returns how the current metadata of the file at path
+// differs from the expected one.
+func diffFileMetadata(path string, expected, current *fileMetadata) []Drift {
+	var drift []Drift
+	if expected.Mode != current.Mode {
+		drift = append(drift, Drift{path, "mode", expected.Mode.String(), current.Mode.String()})
+	}
+
+	if expected.UID != current.UID || expected.GID != current.GID {
+		drift = append(drift, Drift{path, "owner",
+			fmt.Sprintf("%d:%d", expected.UID, expected.GID),
+			fmt.Sprintf("%d:%d", current.UID, current.GID),
+		})
+	}
+
+	if expected.Rdev != current.Rdev {
+		drift = append(drift, Drift{path, "device",
+			fmt.Sprint(expected.Rdev), fmt.Sprint(current.Rdev)})
+	}
+
+	if !equalXattrs(expected.Xattrs, current.Xattrs) {
+		drift = append(drift, Drift{Path: path, Kind: "xattrs"})
+	}
+
+	return drift
+}
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type CheckSuite struct{}
+
+var _ = Suite(&CheckSuite{})
+
+func (s *CheckSuite) TestDiffFileMetadata(c *C) {
+	expected := &fileMetadata{Mode: 0644, UID: 1000, GID: 1000}
+
+	c.Assert(diffFileMetadata("/foo", expected, &fileMetadata{Mode: 0644, UID: 1000, GID: 1000, ModTime: 1}), HasLen, 0)
+	c.Assert(diffFileMetadata("/foo", expected, &fileMetadata{
+		Mode:   0600,
+		UID:    1000,
+		GID:    1000,
+		Xattrs: map[string][]byte{"user.foo": []byte("bar")},
+	}), DeepEquals, []Drift{
+		{Path: "/foo", Kind: "mode", Expected: "-rw-r--r--", Actual: "-rw-------"},
+		{Path: "/foo", Kind: "xattrs"},
+	})
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	filepath "path"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// commandsDir is the directory of the sidecar holding the output of the
+// commands, which is never restored to the system.
+const commandsDir = sidecarDir + "/commands"
+
+// commandSource is a command whose output is snapshotted as the virtual file
+// commandsDir/Name, for the state which is not in files, such as the
+// installed packages.
+type commandSource struct {
+	Name    string        `yaml:"name"`
+	Run     string        `yaml:"run"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// treeName returns the path of the output of the command in the trees.
+func (s commandSource) treeName() (string, error) {
+	name := filepath.Clean(s.Name)
+	if s.Name == "" || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("invalid command name %q", s.Name)
+	}
+
+	return commandsDir + "/" + name, nil
+}
+
+// buildCommandEntries runs the commands of the config and stores their
+// output, returning the index entries of the virtual files. A command which
+// fails is reported and keeps its output of the HEAD commit, if any.
+func (w *Worktree) buildCommandEntries() ([]*index.Entry, error) {
+	var entries []*index.Entry
+	var head *object.Tree
+
+	for _, s := range w.repo.config.Commands {
+		name, err := s.treeName()
+		if err != nil {
+			return nil, err
+		}
+
+		var out bytes.Buffer
+		if err := runShell(s.Run, s.Timeout, nil, &out); err != nil {
+			w.report.fail(name, fmt.Errorf("command %q failed: %v", s.Run, err))
+
+			if head == nil {
+				if head, err = w.headTree(); err != nil {
+					return nil, err
+				}
+			}
+
+			if f, err := head.File(name); err == nil {
+				entries = append(entries, &index.Entry{Name: name, Hash: f.Hash, Mode: filemode.Regular})
+			}
+
+			continue
+		}
+
+		h, err := w.repo.storeBlob(out.Bytes())
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &index.Entry{Name: name, Hash: h, Mode: filemode.Regular})
+	}
+
+	return entries, nil
+}
+
+// headTree returns the tree of the HEAD commit, empty before the first
+// commit.
+func (w *Worktree) headTree() (*object.Tree, error) {
+	head, err := w.repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return &object.Tree{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := w.repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Tree()
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+type CommandsSuite struct {
+	homeFixture
+}
+
+var _ = Suite(&CommandsSuite{})
+
+func (s *CommandsSuite) TestTreeName(c *C) {
+	name, err := commandSource{Name: "dpkg-selections"}.treeName()
+	c.Assert(err, IsNil)
+	c.Assert(name, Equals, ".gimini/commands/dpkg-selections")
+
+	name, err = commandSource{Name: "net/iptables/"}.treeName()
+	c.Assert(err, IsNil)
+	c.Assert(name, Equals, ".gimini/commands/net/iptables")
+
+	for _, n := range []string{"", "/etc/passwd", "..", "../metadata"} {
+		_, err = commandSource{Name: n}.treeName()
+		c.Assert(err, NotNil)
+	}
+}
+
+func (s *CommandsSuite) TestFailedCommandKeepsOutput(c *C) {
+	w, dir := newTestWorktree(c)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "file"), []byte("foo"), 0644), IsNil)
+
+	w.repo.config.Commands = []commandSource{{Name: "packages", Run: "echo foo"}}
+	first := snapshot(c, w, dir)
+
+	w.repo.config.Commands = []commandSource{{Name: "packages", Run: "echo bar; exit 1"}}
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "file"), []byte("bar"), 0644), IsNil)
+	second := snapshot(c, w, dir)
+	c.Assert(w.Report().Errors, HasLen, 1)
+
+	for _, h := range []plumbing.Hash{first, second} {
+		commit, err := w.repo.CommitObject(h)
+		c.Assert(err, IsNil)
+
+		f, err := commit.File(commandsDir + "/packages")
+		c.Assert(err, IsNil)
+
+		out, err := f.Contents()
+		c.Assert(err, IsNil)
+		c.Assert(out, Equals, "foo\n")
+	}
+}
@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	filepath "path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// entropySampleLen is how much of a blob is sampled to estimate the entropy
+// of its content.
+const entropySampleLen = 64 << 10
+
+// compressionConfig is how the blobs are compressed when written as loose
+// objects, always with zlib as git reads nothing else. Packfiles are written
+// by gc at the zlib default level whatever the config. Other algorithms and
+// unknown settings are rejected, rather than ignored.
+type compressionConfig struct {
+	// Level is the zlib level, from 1 to 9, the zlib default when zero.
+	Level int `yaml:"level,omitempty"`
+
+	// Skip are the extensions of the files stored without compression,
+	// such as .jpg or .zip, whose content is already compressed.
+	Skip []string `yaml:"skip,omitempty"`
+
+	// SkipEntropy is the entropy, in bits per byte from 0 to 8, from
+	// which sampled content is stored without compression. Zero disables
+	// sampling.
+	SkipEntropy float64 `yaml:"skip_entropy,omitempty"`
+}
+
+// plainCompressionConfig has the fields of compressionConfig without its
+// yaml methods.
+type plainCompressionConfig compressionConfig
+
+func (c *compressionConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var settings map[string]interface{}
+	if err := unmarshal(&settings); err != nil {
+		return err
+	}
+
+	for name, value := range settings {
+		switch name {
+		case "level", "skip", "skip_entropy":
+		case "algorithm":
+			if value != "zlib" {
+				return fmt.Errorf("invalid compression algorithm %v, only zlib is supported", value)
+			}
+		default:
+			return fmt.Errorf("unknown compression setting %q", name)
+		}
+	}
+
+	if err := unmarshal((*plainCompressionConfig)(c)); err != nil {
+		return err
+	}
+
+	switch {
+	case c.Level < 0 || c.Level > 9:
+		return fmt.Errorf("invalid compression level %d", c.Level)
+	case c.SkipEntropy < 0 || c.SkipEntropy > 8:
+		return fmt.Errorf("invalid compression skip entropy %s", strconv.FormatFloat(c.SkipEntropy, 'g', -1, 64))
+	}
+
+	return nil
+}
+
+func (c compressionConfig) isDefault() bool {
+	return c.Level == 0 && len(c.Skip) == 0 && c.SkipEntropy == 0
+}
+
+// isSkipped returns whether the file named name is stored without
+// compression given its extension.
+func (c compressionConfig) isSkipped(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return false
+	}
+
+	for _, s := range c.Skip {
+		if strings.ToLower("."+strings.TrimPrefix(s, ".")) == ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+// level returns the zlib level of the content, of the file named name when
+// known.
+func (c compressionConfig) level(name string, obj plumbing.EncodedObject) (int, error) {
+	if c.isSkipped(name) {
+		return zlib.NoCompression, nil
+	}
+
+	if c.SkipEntropy > 0 {
+		e, err := sampleEntropy(obj)
+		if err != nil {
+			return 0, err
+		}
+
+		if e >= c.SkipEntropy {
+			return zlib.NoCompression, nil
+		}
+	}
+
+	if c.Level == 0 {
+		return zlib.DefaultCompression, nil
+	}
+
+	return c.Level, nil
+}
+
+// sampleEntropy returns the Shannon entropy, in bits per byte, of the start
+// of the content of the object.
+func sampleEntropy(obj plumbing.EncodedObject) (e float64, err error) {
+	src, err := obj.Reader()
+	if err != nil {
+		return 0, err
+	}
+
+	defer src.Close()
+
+	sample, err := ioutil.ReadAll(io.LimitReader(src, entropySampleLen))
+	if err != nil {
+		return 0, err
+	}
+
+	return entropy(sample), nil
+}
+
+func entropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+
+	var e float64
+	for _, n := range counts {
+		if n != 0 {
+			p := float64(n) / float64(len(data))
+			e -= p * math.Log2(p)
+		}
+	}
+
+	return e
+}
+
+// blobStorer stores blobs compressed following the policy of the config,
+// the extension of the file they hold deciding when known.
+type blobStorer struct {
+	storer.EncodedObjectStorer
+
+	r    *Repository
+	name string
+}
+
+func (s blobStorer) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	return s.r.setBlob(obj, s.name)
+}
+
+// setBlob stores the blob of the file named name, empty when unknown, as a
+// loose object compressed following the policy of the config.
+func (r *Repository) setBlob(obj plumbing.EncodedObject, name string) (plumbing.Hash, error) {
+	c := r.config.Compression
+	if c.isDefault() || obj.Type() != plumbing.BlobObject || r.path == "" {
+		return r.Storer.SetEncodedObject(obj)
+	}
+
+	level, err := c.level(name, obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return r.writeLooseObject(obj, level)
+}
+
+// writeLooseObject writes the object as a loose object compressed at the
+// zlib level, the way git does with its own level setting.
+func (r *Repository) writeLooseObject(obj plumbing.EncodedObject, level int) (h plumbing.Hash, err error) {
+	h = obj.Hash()
+
+	path := r.looseObjectPath(h)
+	if _, err := os.Stat(path); err == nil {
+		return h, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "tmp_obj_")
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := writeCompressedObject(tmp, obj, level); err != nil {
+		tmp.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return h, os.Rename(tmp.Name(), path)
+}
+
+func writeCompressedObject(dst io.Writer, obj plumbing.EncodedObject, level int) (err error) {
+	zw, err := zlib.NewWriterLevel(dst, level)
+	if err != nil {
+		return err
+	}
+
+	src, err := obj.Reader()
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	header := fmt.Sprintf("%s %d\x00", obj.Type(), obj.Size())
+	if _, err := io.WriteString(zw, header); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(zw, src); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
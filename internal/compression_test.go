@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/objfile"
+	"gopkg.in/yaml.v2"
+)
+
+type CompressionSuite struct{}
+
+var _ = Suite(&CompressionSuite{})
+
+func (s *CompressionSuite) TestEntropy(c *C) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+
+	c.Assert(entropy(nil), Equals, 0.0)
+	c.Assert(entropy(bytes.Repeat([]byte{'a'}, 100)), Equals, 0.0)
+	c.Assert(entropy(all), Equals, 8.0)
+}
+
+func (s *CompressionSuite) TestIsSkipped(c *C) {
+	cfg := compressionConfig{Skip: []string{"jpg", ".ZIP"}}
+
+	c.Assert(cfg.isSkipped("/home/a.JPG"), Equals, true)
+	c.Assert(cfg.isSkipped("/home/a.zip"), Equals, true)
+	c.Assert(cfg.isSkipped("/home/a.txt"), Equals, false)
+	c.Assert(cfg.isSkipped("/home/jpg"), Equals, false)
+}
+
+func (s *CompressionSuite) TestUnmarshalCompression(c *C) {
+	c.Assert(yaml.Unmarshal([]byte("compression: {level: 10}"), &config{}), ErrorMatches, `invalid compression level 10`)
+	c.Assert(yaml.Unmarshal([]byte("compression: {algorithm: zstd}"), &config{}), ErrorMatches, `invalid compression algorithm zstd, only zlib is supported`)
+	c.Assert(yaml.Unmarshal([]byte("compression: {levle: 1}"), &config{}), ErrorMatches, `unknown compression setting "levle"`)
+	c.Assert(yaml.Unmarshal([]byte("compression: {algorithm: zlib}"), &config{}), IsNil)
+
+	var cfg config
+	c.Assert(yaml.Unmarshal([]byte("compression: {level: 1, skip_entropy: 7.5}"), &cfg), IsNil)
+	c.Assert(cfg.Compression.isDefault(), Equals, false)
+}
+
+func (s *CompressionSuite) TestWriteCompressedObject(c *C) {
+	obj := &plumbing.MemoryObject{}
+	obj.SetType(plumbing.BlobObject)
+	obj.Write([]byte("foo"))
+
+	for _, level := range []int{zlib.NoCompression, zlib.BestCompression} {
+		var buf bytes.Buffer
+		c.Assert(writeCompressedObject(&buf, obj, level), IsNil)
+
+		r, err := objfile.NewReader(&buf)
+		c.Assert(err, IsNil)
+
+		t, size, err := r.Header()
+		c.Assert(err, IsNil)
+		c.Assert(t, Equals, plumbing.BlobObject)
+		c.Assert(size, Equals, int64(3))
+
+		data, err := ioutil.ReadAll(r)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, "foo")
+		c.Assert(r.Hash(), Equals, obj.Hash())
+	}
+}
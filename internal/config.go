@@ -1,27 +1,138 @@
 package internal
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 
 	"gopkg.in/src-d/go-billy.v4"
-	"gopkg.in/src-d/go-billy.v4/osfs"
 
-	"gopkg.in/src-d/go-git.v4/utils/merkletrie/filesystem"
 	"gopkg.in/src-d/go-git.v4/utils/merkletrie/noder"
+
+	"github.com/WhoMeNope/gimini/internal/utils/merkletrie/filesystem"
 )
 
 const configPath string = "/.gimini/gimini.yaml"
 
+// defaultChunkThreshold is the size from which files are split in chunks when
+// the config does not say otherwise.
+const defaultChunkThreshold byteSize = 64 << 20
+
 type config struct {
-	Paths []string
+	Paths []pathConfig
+
+	// ChunkThreshold is the size from which files are stored as chunks,
+	// a negative value disables chunking.
+	ChunkThreshold byteSize `yaml:"chunk_threshold,omitempty"`
+
+	// Compression is how the blobs are compressed, the zlib default level
+	// being used for all of them when not set.
+	Compression compressionConfig `yaml:"compression,omitempty"`
+
+	// MaxFileSize is the size above which files are left out of the
+	// snapshots, zero disables the limit.
+	MaxFileSize byteSize `yaml:"max_file_size,omitempty"`
+
+	// AnnexRemote is a directory, usually on another disk or a mounted
+	// remote, annexed content is copied to on top of the local store.
+	AnnexRemote string `yaml:"annex_remote,omitempty"`
+
+	// Keep is the policy prune follows when not given one.
+	Keep KeepPolicy `yaml:"keep,omitempty"`
+
+	// Watch is when watch commits the changes it sees.
+	Watch WatchPolicy `yaml:"watch,omitempty"`
+
+	// Hooks are the commands run before and after snapshots and restores.
+	Hooks hooksConfig `yaml:"hooks,omitempty"`
+
+	// Commands are snapshotted by their output, as virtual files below
+	// .gimini/commands in the trees.
+	Commands []commandSource `yaml:"commands,omitempty"`
+
+	// MessageTemplate is the text/template the commit messages are
+	// generated with, given the counts of changes per tracked path, the
+	// first changed paths, the host and what started the snapshot.
+	MessageTemplate string `yaml:"message_template,omitempty"`
+}
+
+// pathConfig is a tracked path along with the options applied to the files
+// below it. A path without options is written as a plain string.
+type pathConfig struct {
+	Path string
+
+	// AnnexThreshold is the size from which files are annexed, recorded as
+	// a pointer and kept out of the object database. Zero disables it.
+	AnnexThreshold byteSize `yaml:"annex_threshold,omitempty"`
+
+	// Special is what to do with the sockets, FIFOs and device nodes below
+	// the path, skipped with a warning by default.
+	Special specialPolicy `yaml:"special,omitempty"`
+
+	// OneFileSystem stops the walk at the directories another filesystem
+	// is mounted on, such as /proc or network mounts, but the ones listed
+	// in Mounts.
+	OneFileSystem bool     `yaml:"one_file_system,omitempty"`
+	Mounts        []string `yaml:"mounts,omitempty"`
+
+	// Symlinks is what to do with the symlinks below the path, stored as
+	// symlinks by default.
+	Symlinks symlinkPolicy `yaml:"symlinks,omitempty"`
+
+	// Schedule is how often run-scheduled snapshots the path, never when
+	// not set.
+	Schedule schedule `yaml:"schedule,omitempty"`
+
+	// MaxFileSize is the size above which files are left out of the
+	// snapshots, replacing the global one. Negative disables the limit.
+	MaxFileSize byteSize `yaml:"max_file_size,omitempty"`
+}
+
+// isMountAllowed returns whether the walk enters the directory at the system
+// path, when it is a mount point.
+func (p pathConfig) isMountAllowed(path string) bool {
+	if !p.OneFileSystem {
+		return true
+	}
+
+	for _, m := range p.Mounts {
+		if filepath.Clean(m) == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// plainPathConfig has the fields of pathConfig without its yaml methods.
+type plainPathConfig pathConfig
+
+func (p *pathConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&p.Path); err == nil {
+		return nil
+	}
+
+	return unmarshal((*plainPathConfig)(p))
+}
+
+func (p pathConfig) MarshalYAML() (interface{}, error) {
+	if reflect.DeepEqual(p, pathConfig{Path: p.Path}) {
+		return p.Path, nil
+	}
+
+	return plainPathConfig(p), nil
 }
 
 func defaultConfig() config {
-	config := config{}
+	config := config{
+		ChunkThreshold: defaultChunkThreshold,
+	}
 	return config
 }
 
@@ -70,32 +181,180 @@ func (c *config) save() error {
 	return ioutil.WriteFile(fullConfigPath, data, 0644)
 }
 
+// add tracks the path, unless it already is or is below a tracked path.
 func (c *config) add(path string) error {
 	path = filepath.Clean(path)
 
-	if isInSlice(c.Paths, path) {
+	if _, ok := c.trackedPath(path); ok {
 		return nil
 	}
 
-	c.Paths = append(c.Paths, path)
+	c.Paths = append(c.Paths, pathConfig{Path: path})
 	return c.save()
 }
 
-func isInSlice(ss []string, v string) bool {
-	for _, s := range ss {
-		if s == v {
-			return true
+// trackedPath returns the config of the tracked path the given system path
+// is at or below, the most specific one when tracked paths are nested.
+func (c *config) trackedPath(path string) (pathConfig, bool) {
+	var found pathConfig
+	var ok bool
+	for _, p := range c.Paths {
+		if isBelowAny(path, []string{p.Path}) && (!ok || len(p.Path) > len(found.Path)) {
+			found, ok = p, true
 		}
 	}
-	return false
+
+	return found, ok
 }
 
-func (c *config) getFilesystemNodes(fs billy.Filesystem) map[string]noder.Noder {
-	nodeMap := make(map[string]noder.Noder)
+func (c *config) chunkThreshold() int64 {
+	switch {
+	case c.ChunkThreshold == 0:
+		return int64(defaultChunkThreshold)
+	case c.ChunkThreshold < 0:
+		return 0
+	}
 
-	for _, path := range c.Paths {
-		nodeMap[path] = filesystem.NewRootNode(osfs.New(path), nil)
+	return int64(c.ChunkThreshold)
+}
+
+// getFilesystemNode returns the noder of the tracked paths in the system
+// filesystem, hashing the files the same way they are stored in the
+// repository. The files which cannot be read are passed to onError.
+func (c *config) getFilesystemNode(fs billy.Filesystem, onError func(path string, err error)) noder.Noder {
+	paths := make(map[string]filesystem.Options)
+	for _, p := range c.Paths {
+		paths[p.Path] = c.nodeOptions(p)
 	}
 
-	return nodeMap
+	return filesystem.NewTrackedRootNode(fs, paths, onError)
+}
+
+// getFilesystemNodeBelow is getFilesystemNode walking only the given system
+// path, at or below a tracked path.
+func (c *config) getFilesystemNodeBelow(fs billy.Filesystem, path string, onError func(path string, err error)) noder.Noder {
+	p, _ := c.trackedPath(path)
+	return filesystem.NewTrackedRootNode(fs, map[string]filesystem.Options{
+		path: c.nodeOptions(p),
+	}, onError)
+}
+
+// nodeOptions returns the options the files below the tracked path are
+// hashed with.
+func (c *config) nodeOptions(p pathConfig) filesystem.Options {
+	options := filesystem.Options{
+		ChunkThreshold: c.chunkThreshold(),
+		AnnexThreshold: int64(p.AnnexThreshold),
+		OneFileSystem:  p.OneFileSystem,
+		MaxFileSize:    c.maxFileSize(p),
+		Follow: func(name string) bool {
+			return c.followsSymlink(systemPath(name))
+		},
+	}
+
+	if len(p.Mounts) != 0 {
+		options.Mounts = make(map[string]bool)
+		for _, m := range p.Mounts {
+			options.Mounts[treePath(filepath.Clean(m))] = true
+		}
+	}
+
+	return options
+}
+
+// specialPolicy is what Add does with special files, which have no content
+// to store.
+type specialPolicy string
+
+const (
+	// specialSkip leaves special files out of the snapshot with a warning.
+	specialSkip specialPolicy = "skip"
+	// specialMetadata records the metadata of special files, device
+	// numbers included, so restore recreates them.
+	specialMetadata specialPolicy = "metadata"
+	// specialFail makes Add fail on special files.
+	specialFail specialPolicy = "fail"
+)
+
+func (p *specialPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	s, err := unmarshalPolicy(unmarshal, "special file",
+		string(specialSkip), string(specialMetadata), string(specialFail))
+
+	*p = specialPolicy(s)
+	return err
+}
+
+// maxFileSize returns the size above which the files below the tracked path
+// are left out, zero when there is no limit.
+func (c *config) maxFileSize(p pathConfig) int64 {
+	switch {
+	case p.MaxFileSize < 0:
+		return 0
+	case p.MaxFileSize > 0:
+		return int64(p.MaxFileSize)
+	}
+
+	return int64(c.MaxFileSize)
+}
+
+// byteSize is a size in bytes, written in the config either as a number or
+// with a binary unit suffix such as "512K", "64M" or "2G".
+type byteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   byteSize
+}{
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+func parseByteSize(s string) (byteSize, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+
+	unit := byteSize(1)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSuffix(s, u.suffix), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return byteSize(n) * unit, nil
+}
+
+func (b byteSize) String() string {
+	for _, u := range byteSizeUnits {
+		if b != 0 && b%u.size == 0 {
+			return strconv.FormatInt(int64(b/u.size), 10) + u.suffix
+		}
+	}
+
+	return strconv.FormatInt(int64(b), 10)
+}
+
+func (b *byteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	size, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+
+	*b = size
+	return nil
+}
+
+func (b byteSize) MarshalYAML() (interface{}, error) {
+	return b.String(), nil
 }
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ConfigSuite struct{}
+
+var _ = Suite(&ConfigSuite{})
+
+func (s *ConfigSuite) TestUnmarshalPaths(c *C) {
+	var cfg config
+	err := yaml.Unmarshal([]byte(`
+paths:
+- /etc
+- path: /home/foo/Videos
+  annex_threshold: 100M
+chunk_threshold: 1G
+`), &cfg)
+
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Paths, DeepEquals, []pathConfig{
+		{Path: "/etc"},
+		{Path: "/home/foo/Videos", AnnexThreshold: 100 << 20},
+	})
+	c.Assert(cfg.ChunkThreshold, Equals, byteSize(1<<30))
+}
+
+func (s *ConfigSuite) TestMarshalPaths(c *C) {
+	cfg := config{Paths: []pathConfig{
+		{Path: "/etc"},
+		{Path: "/home/foo/Videos", AnnexThreshold: 100 << 20},
+	}}
+
+	data, err := yaml.Marshal(&cfg)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `paths:
+- /etc
+- path: /home/foo/Videos
+  annex_threshold: 100M
+`)
+}
+
+func (s *ConfigSuite) TestParseByteSize(c *C) {
+	for input, expected := range map[string]byteSize{
+		"0":    0,
+		"512":  512,
+		"4k":   4 << 10,
+		"64M":  64 << 20,
+		"2 GB": 2 << 30,
+		"1T":   1 << 40,
+		"-1":   -1,
+	} {
+		size, err := parseByteSize(input)
+		c.Assert(err, IsNil, Commentf("input %q", input))
+		c.Assert(size, Equals, expected, Commentf("input %q", input))
+	}
+
+	_, err := parseByteSize("foo")
+	c.Assert(err, NotNil)
+}
+
+func (s *ConfigSuite) TestTrackedPath(c *C) {
+	cfg := config{Paths: []pathConfig{
+		{Path: "/home"},
+		{Path: "/home/foo/Videos", AnnexThreshold: 1},
+	}}
+
+	p, ok := cfg.trackedPath("/home/foo/Videos/bar.mkv")
+	c.Assert(ok, Equals, true)
+	c.Assert(p.Path, Equals, "/home/foo/Videos")
+
+	p, ok = cfg.trackedPath("/home/foo/bar")
+	c.Assert(ok, Equals, true)
+	c.Assert(p.Path, Equals, "/home")
+
+	_, ok = cfg.trackedPath("/etc/hosts")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *ConfigSuite) TestUnmarshalSpecialPolicy(c *C) {
+	var cfg config
+	err := yaml.Unmarshal([]byte(`
+paths:
+- path: /dev
+  special: metadata
+`), &cfg)
+
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Paths[0].Special, Equals, specialMetadata)
+
+	err = yaml.Unmarshal([]byte(`
+paths:
+- path: /dev
+  special: foo
+`), &cfg)
+
+	c.Assert(err, ErrorMatches, `invalid special file policy "foo"`)
+}
+
+func (s *ConfigSuite) TestIsMountAllowed(c *C) {
+	p := pathConfig{Path: "/", OneFileSystem: true, Mounts: []string{"/home/"}}
+
+	c.Assert(p.isMountAllowed("/home"), Equals, true)
+	c.Assert(p.isMountAllowed("/proc"), Equals, false)
+	c.Assert(pathConfig{Path: "/"}.isMountAllowed("/proc"), Equals, true)
+}
+
+func (s *ConfigSuite) TestMaxFileSize(c *C) {
+	var cfg config
+	err := yaml.Unmarshal([]byte(`
+paths:
+- /etc
+- path: /home
+  max_file_size: 1G
+- path: /srv
+  max_file_size: -1
+max_file_size: 100M
+`), &cfg)
+
+	c.Assert(err, IsNil)
+	c.Assert(cfg.maxFileSize(cfg.Paths[0]), Equals, int64(100<<20))
+	c.Assert(cfg.maxFileSize(cfg.Paths[1]), Equals, int64(1<<30))
+	c.Assert(cfg.maxFileSize(cfg.Paths[2]), Equals, int64(0))
+}
@@ -0,0 +1,297 @@
+package internal
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Usage is the space the files below a path take in a snapshot. The data
+// stored for them alone is unique, the data also stored for files elsewhere
+// in the snapshot, such as copies, is shared.
+type Usage struct {
+	Path   string
+	Unique int64
+	Shared int64
+}
+
+// Growth is the new data stored for the files below a path over a range of
+// snapshots.
+type Growth struct {
+	Path  string
+	Size  int64
+	Files int
+}
+
+// storedObject is a piece of data a file is stored as, a blob, a chunk or
+// annexed content, told apart by its key.
+type storedObject struct {
+	key  string
+	size int64
+}
+
+// usageWalker attributes the objects of the files of snapshots to the paths
+// they are grouped by.
+type usageWalker struct {
+	r     *Repository
+	depth int
+	// objects are the stored objects of the blobs, read once
+	objects map[plumbing.Hash][]storedObject
+}
+
+func (r *Repository) newUsageWalker(depth int) *usageWalker {
+	return &usageWalker{r: r, depth: depth, objects: make(map[plumbing.Hash][]storedObject)}
+}
+
+// DiskUsage returns the usage of the tracked paths and of their directories
+// down to depth in the snapshot, sorted by path. The sidecar is reported as
+// .gimini.
+func (r *Repository) DiskUsage(commit plumbing.Hash, depth int) ([]Usage, error) {
+	u := r.newUsageWalker(depth)
+
+	owners := make(map[string]map[string]bool)
+	sizes := make(map[string]int64)
+
+	err := u.walkFiles(commit, func(group string, objects []storedObject) {
+		for _, o := range objects {
+			if owners[o.key] == nil {
+				owners[o.key] = make(map[string]bool)
+			}
+
+			owners[o.key][group] = true
+			sizes[o.key] = o.size
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]*Usage)
+	for key, groups := range owners {
+		for g := range groups {
+			if usage[g] == nil {
+				usage[g] = &Usage{Path: g}
+			}
+
+			if len(groups) == 1 {
+				usage[g].Unique += sizes[key]
+			} else {
+				usage[g].Shared += sizes[key]
+			}
+		}
+	}
+
+	var res []Usage
+	for _, us := range usage {
+		res = append(res, *us)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+
+	return res, nil
+}
+
+// GrowthBetween returns the data the snapshots of every branch committed
+// between since and until added to the repository, by path down to depth,
+// the most first. Data is new when no earlier snapshot of the range, nor the
+// one before it on each branch, stores it. Older snapshots are not looked
+// at: data deleted before that last one and stored again in the range counts
+// as new.
+func (r *Repository) GrowthBetween(since, until time.Time, depth int) ([]Growth, error) {
+	histories, err := r.histories()
+	if err != nil {
+		return nil, err
+	}
+
+	// the snapshots of the range, and the one before on each branch
+	var commits []*object.Commit
+	var before []plumbing.Hash
+
+	for _, history := range histories {
+		for _, c := range history {
+			when := c.Committer.When
+			if when.After(until) {
+				continue
+			}
+
+			if when.Before(since) {
+				before = append(before, c.Hash)
+				break
+			}
+
+			commits = append(commits, c)
+		}
+	}
+
+	// from the oldest
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Committer.When.Before(commits[j].Committer.When)
+	})
+
+	u := r.newUsageWalker(depth)
+	seen := make(map[string]bool)
+
+	for _, h := range before {
+		err := u.walkFiles(h, func(group string, objects []storedObject) {
+			for _, o := range objects {
+				seen[o.key] = true
+			}
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	growth := make(map[string]*Growth)
+	for _, c := range commits {
+		err := u.walkFiles(c.Hash, func(group string, objects []storedObject) {
+			var size int64
+			for _, o := range objects {
+				if !seen[o.key] {
+					seen[o.key] = true
+					size += o.size
+				}
+			}
+
+			if size == 0 {
+				return
+			}
+
+			if growth[group] == nil {
+				growth[group] = &Growth{Path: group}
+			}
+
+			growth[group].Size += size
+			growth[group].Files++
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var res []Growth
+	for _, g := range growth {
+		res = append(res, *g)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Size != res[j].Size {
+			return res[i].Size > res[j].Size
+		}
+
+		return res[i].Path < res[j].Path
+	})
+
+	return res, nil
+}
+
+// walkFiles calls fn with the group and the stored objects of every file of
+// the commit.
+func (u *usageWalker) walkFiles(commit plumbing.Hash, fn func(group string, objects []storedObject)) error {
+	c, err := u.r.CommitObject(commit)
+	if err != nil {
+		return err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return err
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if entry.Mode == filemode.Dir || entry.Mode == filemode.Submodule {
+			continue
+		}
+
+		objects, err := u.storedObjects(entry.Hash)
+		if err != nil {
+			return err
+		}
+
+		fn(u.group(name), objects)
+	}
+}
+
+// group returns the path the file is accounted to: its tracked path, or
+// the directory below it at depth.
+func (u *usageWalker) group(name string) string {
+	if isSidecar(name) {
+		return sidecarDir
+	}
+
+	path := systemPath(name)
+
+	root := "/"
+	if p, ok := u.r.config.trackedPath(path); ok {
+		root = p.Path
+	}
+
+	rest := strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, root), "/"), "/")
+
+	// the last element is the file itself
+	n := len(rest) - 1
+	if n > u.depth {
+		n = u.depth
+	}
+
+	if root == path || n == 0 {
+		return root
+	}
+
+	return strings.TrimSuffix(root, "/") + "/" + strings.Join(rest[:n], "/")
+}
+
+// storedObjects returns the objects the file stored in the blob takes: the
+// blob, and its chunks or annexed content.
+func (u *usageWalker) storedObjects(h plumbing.Hash) ([]storedObject, error) {
+	if objects, ok := u.objects[h]; ok {
+		return objects, nil
+	}
+
+	obj, err := u.r.Storer.EncodedObject(plumbing.BlobObject, h)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []storedObject{{key: h.String(), size: obj.Size()}}
+
+	m, p, err := u.r.decodeBlob(h)
+	if err != nil {
+		return nil, err
+	}
+
+	if m != nil {
+		for _, c := range m.Chunks {
+			objects = append(objects, storedObject{key: c.Hash.String(), size: c.Size})
+		}
+	}
+
+	if p != nil {
+		objects = append(objects, storedObject{key: "annex:" + p.Key, size: p.Size})
+	}
+
+	u.objects[h] = objects
+	return objects, nil
+}
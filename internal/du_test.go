@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+type DUSuite struct {
+	homeFixture
+}
+
+var _ = Suite(&DUSuite{})
+
+func (s *DUSuite) TestGroup(c *C) {
+	r := &Repository{config: config{Paths: []pathConfig{
+		{Path: "/etc"},
+		{Path: "/home/user/notes.txt"},
+	}}}
+
+	u := r.newUsageWalker(1)
+	c.Assert(u.group("etc/hosts"), Equals, "/etc")
+	c.Assert(u.group("etc/nginx/sites/default"), Equals, "/etc/nginx")
+	c.Assert(u.group("home/user/notes.txt"), Equals, "/home/user/notes.txt")
+	c.Assert(u.group("var/lib/x"), Equals, "/var")
+	c.Assert(u.group(".gimini/metadata"), Equals, ".gimini")
+
+	u = r.newUsageWalker(0)
+	c.Assert(u.group("etc/nginx/sites/default"), Equals, "/etc")
+
+	u = r.newUsageWalker(2)
+	c.Assert(u.group("etc/nginx/sites/default"), Equals, "/etc/nginx/sites")
+}
+
+func (s *DUSuite) TestGrowthBetweenEveryBranch(c *C) {
+	w, dir := newTestWorktree(c)
+
+	commits := snapshots(c, w, dir, "foo", "bar")
+
+	// the second snapshot only is on the branch of another host
+	head, err := w.repo.Head()
+	c.Assert(err, IsNil)
+	c.Assert(w.repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), commits[0])), IsNil)
+	c.Assert(w.repo.Storer.SetReference(plumbing.NewHashReference("refs/heads/other", commits[1])), IsNil)
+
+	second, err := w.repo.CommitObject(commits[1])
+	c.Assert(err, IsNil)
+	when := second.Committer.When
+
+	growth, err := w.repo.GrowthBetween(when.Add(-time.Hour), when.Add(time.Hour), 0)
+	c.Assert(err, IsNil)
+
+	var files int
+	for _, g := range growth {
+		if g.Path == dir {
+			files = g.Files
+		}
+	}
+
+	c.Assert(files, Equals, 1)
+}
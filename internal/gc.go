@@ -0,0 +1,493 @@
+package internal
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/idxfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// GCResult tells what a garbage collection removed, or would remove when
+// dry running.
+type GCResult struct {
+	// Objects is the number of unreachable objects.
+	Objects int
+	// Annexed is the number of unreferenced annexed contents.
+	Annexed int
+	// Size is the space reclaimed on disk, in bytes.
+	Size int64
+}
+
+// liveSet holds the objects and annexed content still referenced. Unlike
+// the object walker of go-git, it follows the chunks of manifests and the
+// content of annex pointers, which no tree references directly.
+type liveSet struct {
+	r       *Repository
+	objects map[plumbing.Hash]bool
+	annex   map[string]bool
+}
+
+func (r *Repository) newLiveSet() *liveSet {
+	return &liveSet{
+		r:       r,
+		objects: make(map[plumbing.Hash]bool),
+		annex:   make(map[string]bool),
+	}
+}
+
+// markRefs marks the objects reachable from every reference.
+func (l *liveSet) markRefs() error {
+	refs, err := l.r.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		return l.markObject(ref.Hash())
+	})
+}
+
+// markIndex marks the blobs of the index, staged but not committed yet.
+func (l *liveSet) markIndex() error {
+	idx, err := l.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Mode == filemode.Submodule {
+			continue
+		}
+
+		if err := l.markBlob(e.Hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markObject marks the object and the ones reachable from it, whatever its
+// type.
+func (l *liveSet) markObject(h plumbing.Hash) error {
+	obj, err := l.r.Storer.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return err
+	}
+
+	switch obj.Type() {
+	case plumbing.CommitObject:
+		return l.markCommit(h, true)
+	case plumbing.TreeObject:
+		return l.markTree(h)
+	case plumbing.BlobObject:
+		return l.markBlob(h)
+	case plumbing.TagObject:
+		l.objects[h] = true
+
+		tag, err := object.DecodeTag(l.r.Storer, obj)
+		if err != nil {
+			return err
+		}
+
+		return l.markObject(tag.Target)
+	}
+
+	return nil
+}
+
+// markCommit marks the commit and its tree, and its ancestors when parents
+// is set.
+func (l *liveSet) markCommit(h plumbing.Hash, parents bool) error {
+	pending := []plumbing.Hash{h}
+	for len(pending) != 0 {
+		h, pending = pending[len(pending)-1], pending[:len(pending)-1]
+		if l.objects[h] {
+			continue
+		}
+
+		c, err := l.r.CommitObject(h)
+		if err != nil {
+			return err
+		}
+
+		l.objects[h] = true
+		if err := l.markTree(c.TreeHash); err != nil {
+			return err
+		}
+
+		if parents {
+			pending = append(pending, c.ParentHashes...)
+		}
+	}
+
+	return nil
+}
+
+func (l *liveSet) markTree(h plumbing.Hash) error {
+	if l.objects[h] {
+		return nil
+	}
+
+	tree, err := l.r.TreeObject(h)
+	if err != nil {
+		return err
+	}
+
+	l.objects[h] = true
+	for _, e := range tree.Entries {
+		switch e.Mode {
+		case filemode.Dir:
+			err = l.markTree(e.Hash)
+		case filemode.Submodule:
+		default:
+			err = l.markBlob(e.Hash)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markBlob marks the blob, along with the chunks it lists when it is a
+// manifest or the annexed content it points to when it is a pointer.
+func (l *liveSet) markBlob(h plumbing.Hash) error {
+	if l.objects[h] {
+		return nil
+	}
+
+	m, p, err := l.r.decodeBlob(h)
+	if err != nil {
+		return err
+	}
+
+	l.objects[h] = true
+	if m != nil {
+		for _, c := range m.Chunks {
+			l.objects[c.Hash] = true
+		}
+	}
+
+	if p != nil {
+		l.annex[p.Key] = true
+	}
+
+	return nil
+}
+
+// looseObjectTime is the age below which unreachable loose objects and annexed
+// content are kept, as they may be written by an Add not staged yet, like git
+// prune does.
+const looseObjectTime = 14 * 24 * time.Hour
+
+// removeUnreachable deletes the loose objects and the local annexed content
+// older than looseObjectTime which are not in the live set, or only counts
+// them when dry running. The unreachable packed objects are counted too, they
+// are deleted by repack.
+func (r *Repository) removeUnreachable(l *liveSet, dryRun bool) (*GCResult, error) {
+	res := &GCResult{}
+
+	los, ok := r.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return nil, git.ErrLooseObjectsNotSupported
+	}
+
+	var dead []plumbing.Hash
+	err := los.ForEachObjectHash(func(h plumbing.Hash) error {
+		if !l.objects[h] {
+			dead = append(dead, h)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := time.Now().Add(-looseObjectTime)
+	for _, h := range dead {
+		fi, err := os.Stat(r.looseObjectPath(h))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		if fi.ModTime().After(expiry) {
+			continue
+		}
+
+		res.Size += fi.Size()
+		res.Objects++
+		if dryRun {
+			continue
+		}
+
+		if err := los.DeleteLooseObject(h); err != nil {
+			return nil, err
+		}
+	}
+
+	packed, err := r.packedObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	for h, size := range packed {
+		if !l.objects[h] {
+			res.Objects++
+			res.Size += size
+		}
+	}
+
+	err = r.annex.ForEach(func(key string) error {
+		if l.annex[key] {
+			return nil
+		}
+
+		// annexed by an Add not staged yet, like a loose object
+		fi, err := r.annex.Stat(key)
+		if err != nil {
+			return err
+		}
+
+		if fi.ModTime().After(expiry) {
+			return nil
+		}
+
+		res.Annexed++
+		res.Size += fi.Size()
+		if dryRun {
+			return nil
+		}
+
+		return r.annex.Remove(key)
+	})
+
+	return res, err
+}
+
+// GC deletes the objects and the local annexed content neither a reference
+// nor the index reaches, but for the recent loose objects, then packs the
+// remaining objects in a single packfile with deltas. When dry running
+// nothing is changed and the result tells what would be deleted, before
+// packing.
+func (r *Repository) GC(dryRun bool) (*GCResult, error) {
+	l := r.newLiveSet()
+	if err := l.markRefs(); err != nil {
+		return nil, err
+	}
+
+	if err := l.markIndex(); err != nil {
+		return nil, err
+	}
+
+	return r.collectGarbage(l, dryRun)
+}
+
+// collectGarbage removes what is not in the live set and repacks the rest.
+func (r *Repository) collectGarbage(l *liveSet, dryRun bool) (*GCResult, error) {
+	res, err := r.removeUnreachable(l, dryRun)
+	if err != nil || dryRun {
+		return res, err
+	}
+
+	return res, r.repack(l)
+}
+
+// repack writes the live objects to a new packfile, with deltas, and deletes
+// them as loose objects and the previous packfiles, along with the
+// unreachable objects they held.
+func (r *Repository) repack(l *liveSet) (err error) {
+	pos, ok := r.Storer.(storer.PackedObjectStorer)
+	if !ok {
+		return git.ErrPackedObjectsNotSupported
+	}
+
+	los, ok := r.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return git.ErrLooseObjectsNotSupported
+	}
+
+	packs, err := pos.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	// the live loose objects are deleted once packed, the unreachable ones
+	// left are too recent to be removed
+	var loose []plumbing.Hash
+	err = los.ForEachObjectHash(func(h plumbing.Hash) error {
+		if l.objects[h] {
+			loose = append(loose, h)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	var objects []plumbing.Hash
+	for h := range l.objects {
+		if r.Storer.HasEncodedObject(h) == nil {
+			objects = append(objects, h)
+		}
+	}
+
+	if len(objects) == 0 {
+		return nil
+	}
+
+	pack, err := r.writePackfile(objects)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range packs {
+		if h == pack {
+			continue
+		}
+
+		if err := pos.DeleteOldObjectPackAndIndex(h, time.Time{}); err != nil {
+			return err
+		}
+	}
+
+	if s, ok := r.Storer.(interface{ Reindex() }); ok {
+		// forget the deleted packfiles
+		s.Reindex()
+	}
+
+	for _, h := range loose {
+		if err := los.DeleteLooseObject(h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// packedObjects returns the objects of every packfile along with the space
+// they take in it.
+func (r *Repository) packedObjects() (map[plumbing.Hash]int64, error) {
+	pos, ok := r.Storer.(storer.PackedObjectStorer)
+	if !ok {
+		return nil, nil
+	}
+
+	packs, err := pos.ObjectPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make(map[plumbing.Hash]int64)
+	for _, h := range packs {
+		if err := r.readPackIndex(h, objects); err != nil {
+			return nil, err
+		}
+	}
+
+	return objects, nil
+}
+
+// readPackIndex adds the objects of the packfile to objects, their size
+// being the distance to the next object, or to the trailing checksum.
+func (r *Repository) readPackIndex(pack plumbing.Hash, objects map[plumbing.Hash]int64) (err error) {
+	name := filepath.Join(r.path, "objects", "pack", "pack-"+pack.String())
+
+	fi, err := os.Stat(name + ".pack")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(name + ".idx")
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	idx := idxfile.NewMemoryIndex()
+	if err := idxfile.NewDecoder(f).Decode(idx); err != nil {
+		return err
+	}
+
+	entries, err := idx.EntriesByOffset()
+	if err != nil {
+		return err
+	}
+
+	defer entries.Close()
+
+	var prev *idxfile.Entry
+	for {
+		e, err := entries.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if prev != nil {
+			objects[prev.Hash] = int64(e.Offset - prev.Offset)
+		}
+
+		prev = e
+	}
+
+	if prev != nil {
+		objects[prev.Hash] = fi.Size() - int64(len(plumbing.ZeroHash)) - int64(prev.Offset)
+	}
+
+	return nil
+}
+
+func (r *Repository) writePackfile(objects []plumbing.Hash) (h plumbing.Hash, err error) {
+	pfw, ok := r.Storer.(storer.PackfileWriter)
+	if !ok {
+		return h, git.ErrPackedObjectsNotSupported
+	}
+
+	w, err := pfw.PackfileWriter()
+	if err != nil {
+		return h, err
+	}
+
+	defer ioutil.CheckClose(w, &err)
+
+	cfg, err := r.Storer.Config()
+	if err != nil {
+		return h, err
+	}
+
+	return packfile.NewEncoder(w, r.Storer, false).Encode(objects, cfg.Pack.Window)
+}
+
+// looseObjectPath returns the path of the file holding the loose object.
+func (r *Repository) looseObjectPath(h plumbing.Hash) string {
+	hex := h.String()
+	return filepath.Join(r.path, "objects", hex[:2], hex[2:])
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	"github.com/WhoMeNope/gimini/internal/utils/annex"
+	"github.com/WhoMeNope/gimini/internal/utils/chunker"
+)
+
+type GCSuite struct {
+	homeFixture
+}
+
+var _ = Suite(&GCSuite{})
+
+func (s *GCSuite) TestMarkBlob(c *C) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	c.Assert(err, IsNil)
+
+	r := &Repository{Repository: *repo, annex: annex.NewStore(memfs.New())}
+
+	data := bytes.Repeat([]byte("foo"), 1<<20)
+	manifest, err := chunker.Store(r.Storer, bytes.NewReader(data))
+	c.Assert(err, IsNil)
+
+	p, err := annex.NewPointer(strings.NewReader("foo"))
+	c.Assert(err, IsNil)
+	pointer, err := r.storeBlob(p.Bytes())
+	c.Assert(err, IsNil)
+
+	l := r.newLiveSet()
+	c.Assert(l.markBlob(manifest), IsNil)
+	c.Assert(l.markBlob(pointer), IsNil)
+
+	c.Assert(l.objects[manifest], Equals, true)
+	c.Assert(l.objects[pointer], Equals, true)
+	c.Assert(l.annex, DeepEquals, map[string]bool{p.Key: true})
+
+	err = chunker.Split(bytes.NewReader(data), func(chunk []byte) error {
+		c.Assert(l.objects[plumbing.ComputeHash(plumbing.BlobObject, chunk)], Equals, true)
+		return nil
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *GCSuite) TestCollectGarbage(c *C) {
+	w, dir := newTestWorktree(c)
+
+	file := filepath.Join(dir, "file")
+	c.Assert(ioutil.WriteFile(file, []byte("foo"), 0644), IsNil)
+	first := snapshot(c, w, dir)
+	c.Assert(ioutil.WriteFile(file, []byte("bar"), 0644), IsNil)
+	second := snapshot(c, w, dir)
+
+	// unreachable, the recent one could be written by an Add in progress
+	recent, err := w.repo.storeBlob([]byte("recent"))
+	c.Assert(err, IsNil)
+	old, err := w.repo.storeBlob([]byte("old"))
+	c.Assert(err, IsNil)
+
+	past := time.Now().Add(-2 * looseObjectTime)
+	c.Assert(os.Chtimes(w.repo.looseObjectPath(old), past, past), IsNil)
+
+	l := w.repo.newLiveSet()
+	c.Assert(l.markRefs(), IsNil)
+	c.Assert(l.markIndex(), IsNil)
+
+	res, err := w.repo.removeUnreachable(l, false)
+	c.Assert(err, IsNil)
+	c.Assert(res.Objects, Equals, 1)
+	c.Assert(w.repo.repack(l), IsNil)
+
+	c.Assert(w.repo.Storer.HasEncodedObject(old), NotNil)
+	c.Assert(w.repo.Storer.HasEncodedObject(recent), IsNil)
+
+	for commit, content := range map[plumbing.Hash]string{first: "foo", second: "bar"} {
+		c.Assert(os.Remove(file), IsNil)
+		c.Assert(w.Restore(commit, file), IsNil)
+
+		data, err := ioutil.ReadFile(file)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, content)
+	}
+}
+
+func (s *GCSuite) TestCollectGarbageAnnex(c *C) {
+	w, _ := newTestWorktree(c)
+
+	// unreferenced, the fresh one could be annexed by an Add in progress
+	fresh, err := w.repo.annex.Put(strings.NewReader("fresh"))
+	c.Assert(err, IsNil)
+	old, err := w.repo.annex.Put(strings.NewReader("old"))
+	c.Assert(err, IsNil)
+
+	past := time.Now().Add(-2 * looseObjectTime)
+	path := filepath.Join(w.repo.annex.Root(), old.Key[:2], old.Key[2:])
+	c.Assert(os.Chtimes(path, past, past), IsNil)
+
+	res, err := w.repo.GC(false)
+	c.Assert(err, IsNil)
+	c.Assert(res.Annexed, Equals, 1)
+
+	c.Assert(w.repo.annex.Has(fresh.Key), Equals, true)
+	c.Assert(w.repo.annex.Has(old.Key), Equals, false)
+}
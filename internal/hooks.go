@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	filepath "path"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// hooksPath is the directory, inside the repo, of the executable hooks, each
+// named after the event it runs on, such as pre-add.
+const hooksPath string = "/hooks"
+
+// defaultHookTimeout is how long a hook may run when the config does not
+// say otherwise.
+const defaultHookTimeout = 10 * time.Minute
+
+// hookEvent is when a hook runs.
+type hookEvent string
+
+const (
+	preAdd      hookEvent = "pre-add"
+	preCommit   hookEvent = "pre-commit"
+	postCommit  hookEvent = "post-commit"
+	postRestore hookEvent = "post-restore"
+)
+
+// hooksConfig lists the commands run on each event, before the executable
+// hooks of the repo.
+type hooksConfig struct {
+	PreAdd      []hook `yaml:"pre_add,omitempty"`
+	PreCommit   []hook `yaml:"pre_commit,omitempty"`
+	PostCommit  []hook `yaml:"post_commit,omitempty"`
+	PostRestore []hook `yaml:"post_restore,omitempty"`
+}
+
+func (c hooksConfig) hooks(e hookEvent) []hook {
+	switch e {
+	case preAdd:
+		return c.PreAdd
+	case preCommit:
+		return c.PreCommit
+	case postCommit:
+		return c.PostCommit
+	case postRestore:
+		return c.PostRestore
+	}
+
+	return nil
+}
+
+// hook is a shell command, killed after Timeout.
+type hook struct {
+	Run       string            `yaml:"run"`
+	Timeout   time.Duration     `yaml:"timeout,omitempty"`
+	OnFailure hookFailurePolicy `yaml:"on_failure,omitempty"`
+}
+
+// hookFailurePolicy is what a failing hook does to the command running it.
+type hookFailurePolicy string
+
+const (
+	// hookAbort makes the command fail, before doing anything for the pre
+	// hooks. It is the default.
+	hookAbort hookFailurePolicy = "abort"
+	// hookWarn reports the failure as a warning and goes on.
+	hookWarn hookFailurePolicy = "warn"
+)
+
+func (p *hookFailurePolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	s, err := unmarshalPolicy(unmarshal, "hook failure", string(hookAbort), string(hookWarn))
+
+	*p = hookFailurePolicy(s)
+	return err
+}
+
+// PreAdd runs the pre-add hooks for the paths about to be added, once per
+// snapshot whatever the number of paths.
+func (w *Worktree) PreAdd(paths []string) error {
+	return w.runHooks(preAdd, paths, plumbing.ZeroHash)
+}
+
+// runHooks runs the hooks of the event, the configured ones then the
+// executable of the repo, telling them the paths and the commit in their
+// environment.
+func (w *Worktree) runHooks(e hookEvent, paths []string, commit plumbing.Hash) error {
+	hooks := w.repo.config.Hooks.hooks(e)
+
+	exe := filepath.Join(w.repo.path+hooksPath, string(e))
+	if fi, err := os.Stat(exe); err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+		hooks = append(hooks, hook{Run: exe})
+	}
+
+	env := append(os.Environ(),
+		"GIMINI_HOOK="+string(e),
+		"GIMINI_REPO="+w.repo.path,
+		"GIMINI_PATHS="+strings.Join(paths, "\n"),
+	)
+	if !commit.IsZero() {
+		env = append(env, "GIMINI_COMMIT="+commit.String())
+	}
+
+	for _, h := range hooks {
+		err := h.exec(env)
+		if err == nil {
+			continue
+		}
+
+		if h.OnFailure == hookWarn {
+			w.report.warn("%s hook %q failed: %v", e, h.Run, err)
+			continue
+		}
+
+		return fmt.Errorf("%s hook %q failed: %v", e, h.Run, err)
+	}
+
+	return nil
+}
+
+// exec runs the hook with the environment, its output going to stderr so
+// that it does not mix with the output of the command.
+func (h hook) exec(env []string) error {
+	return runShell(h.Run, h.Timeout, env, os.Stderr)
+}
+
+// runShell runs the shell command with the environment, killing it after
+// the timeout, or the default hook timeout when not set.
+func runShell(run string, timeout time.Duration, env []string, stdout io.Writer) error {
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", run)
+	cmd.Env = env
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+
+	return err
+}
+
+// trackedPaths returns the tracked paths of the config.
+func (c *config) trackedPaths() []string {
+	var paths []string
+	for _, p := range c.Paths {
+		paths = append(paths, p.Path)
+	}
+
+	return paths
+}
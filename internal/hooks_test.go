@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
+)
+
+type HooksSuite struct {
+	homeFixture
+}
+
+var _ = Suite(&HooksSuite{})
+
+func (s *HooksSuite) TestUnmarshalHooks(c *C) {
+	var cfg config
+	err := yaml.Unmarshal([]byte(`
+hooks:
+  pre_add:
+  - run: pg_dumpall > /var/backups/pg.sql
+    timeout: 30m
+  post_restore:
+  - run: systemctl restart postgresql
+    on_failure: warn
+`), &cfg)
+
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Hooks.hooks(preAdd), DeepEquals, []hook{
+		{Run: "pg_dumpall > /var/backups/pg.sql", Timeout: 30 * time.Minute},
+	})
+	c.Assert(cfg.Hooks.hooks(postRestore)[0].OnFailure, Equals, hookWarn)
+	c.Assert(cfg.Hooks.hooks(preCommit), HasLen, 0)
+}
+
+func (s *HooksSuite) TestExec(c *C) {
+	c.Assert(hook{Run: "test \"$GIMINI_HOOK\" = pre-add"}.exec([]string{"GIMINI_HOOK=pre-add"}), IsNil)
+	c.Assert(hook{Run: "exit 2"}.exec(nil), ErrorMatches, "exit status 2")
+	c.Assert(hook{Run: "sleep 5", Timeout: 10 * time.Millisecond}.exec(nil), ErrorMatches, "timed out after 10ms")
+}
+
+func (s *HooksSuite) TestPreAddOncePerSnapshot(c *C) {
+	w, dir := newTestWorktree(c)
+
+	runs := filepath.Join(c.MkDir(), "runs")
+	w.repo.config.Hooks.PreAdd = []hook{{Run: "echo \"$GIMINI_PATHS\" >> " + runs}}
+
+	foo, bar := filepath.Join(dir, "foo"), filepath.Join(dir, "bar")
+	c.Assert(os.Mkdir(foo, 0755), IsNil)
+	c.Assert(os.Mkdir(bar, 0755), IsNil)
+
+	c.Assert(w.PreAdd([]string{foo, bar}), IsNil)
+	for _, p := range []string{foo, bar} {
+		_, err := w.Add(p)
+		c.Assert(err, IsNil)
+	}
+
+	data, err := ioutil.ReadFile(runs)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, foo+"\n"+bar+"\n")
+}
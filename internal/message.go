@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/utils/merkletrie"
+)
+
+// Trigger is what started a snapshot, told in its generated message.
+type Trigger string
+
+const (
+	TriggerManual Trigger = "manual"
+	TriggerCron   Trigger = "cron"
+	TriggerWatch  Trigger = "watch"
+)
+
+// maxTopPaths is the number of changed paths listed in generated messages.
+const maxTopPaths = 10
+
+// defaultMessageTemplate is the template of the generated messages when the
+// config does not give one.
+const defaultMessageTemplate = `{{.Trigger}} snapshot of {{.Host}}: {{.Added}} added, {{.Modified}} modified, {{.Deleted}} deleted
+{{if .Roots}}
+{{range .Roots}}{{.Path}}: {{.Added}} added, {{.Modified}} modified, {{.Deleted}} deleted
+{{end}}{{end}}{{if .Top}}
+{{range .Top}}{{.}}
+{{end}}{{if .More}}... and {{.More}} more
+{{end}}{{end}}`
+
+// changeSummary is what the message templates are executed with.
+type changeSummary struct {
+	Trigger Trigger
+	Host    string
+	Time    time.Time
+
+	Added, Modified, Deleted int
+
+	// Roots are the counts per tracked path, the output of the commands
+	// being counted under .gimini/commands.
+	Roots []*rootSummary
+
+	// Top are the first changed paths, prefixed by A, M or D, and More
+	// the number of the other ones.
+	Top  []string
+	More int
+}
+
+type rootSummary struct {
+	Path                     string
+	Added, Modified, Deleted int
+}
+
+// SetTrigger sets what started the snapshots committed by the worktree,
+// manual by default.
+func (w *Worktree) SetTrigger(t Trigger) {
+	w.trigger = t
+}
+
+// buildMessage generates the message of the commit of the tree, from its
+// changes since HEAD.
+func (w *Worktree) buildMessage(tree plumbing.Hash) (string, error) {
+	s, err := w.summarizeChanges(tree)
+	if err != nil {
+		return "", err
+	}
+
+	text := w.repo.config.MessageTemplate
+	if text == "" {
+		text = defaultMessageTemplate
+	}
+
+	t, err := template.New("message").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var msg bytes.Buffer
+	if err := t.Execute(&msg, s); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(msg.String()) + "\n", nil
+}
+
+// summarizeChanges counts the files of the tree added, modified and deleted
+// since HEAD, the ones whose metadata alone changed being modified.
+func (w *Worktree) summarizeChanges(tree plumbing.Hash) (*changeSummary, error) {
+	s := &changeSummary{Trigger: w.trigger, Time: time.Now()}
+	if s.Trigger == "" {
+		s.Trigger = TriggerManual
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	s.Host = host
+
+	head, err := w.headTree()
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := object.GetTree(w.repo.Storer, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(head, to)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := make(map[string]*rootSummary)
+	var paths []string
+
+	count := func(a merkletrie.Action, name string) {
+		root := commandsDir
+		if !strings.HasPrefix(name, commandsDir+"/") {
+			name = systemPath(name)
+			p, _ := w.repo.config.trackedPath(name)
+			root = p.Path
+		}
+
+		r, ok := roots[root]
+		if !ok {
+			r = &rootSummary{Path: root}
+			roots[root] = r
+			s.Roots = append(s.Roots, r)
+		}
+
+		switch a {
+		case merkletrie.Insert:
+			s.Added++
+			r.Added++
+			paths = append(paths, "A "+name)
+		case merkletrie.Modify:
+			s.Modified++
+			r.Modified++
+			paths = append(paths, "M "+name)
+		case merkletrie.Delete:
+			s.Deleted++
+			r.Deleted++
+			paths = append(paths, "D "+name)
+		}
+	}
+
+	counted := make(map[string]bool)
+	for _, ch := range changes {
+		a, err := ch.Action()
+		if err != nil {
+			return nil, err
+		}
+
+		name := ch.To.Name
+		if a == merkletrie.Delete {
+			name = ch.From.Name
+		}
+
+		if isSidecar(name) && !strings.HasPrefix(name, commandsDir+"/") {
+			continue
+		}
+
+		counted[name] = true
+		count(a, name)
+	}
+
+	// The changes of the metadata alone, like a chmod, and of the special
+	// files, recorded by their metadata alone, are only in the sidecar
+	before, err := treeMetadata(head)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := treeMetadata(to)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, m := range after {
+		if counted[name] {
+			continue
+		}
+
+		old, ok := before[name]
+		switch {
+		case !ok && isSpecial(m.Mode):
+			count(merkletrie.Insert, name)
+		case ok && m.changed(old):
+			count(merkletrie.Modify, name)
+		}
+	}
+
+	for name, m := range before {
+		if _, ok := after[name]; !ok && !counted[name] && isSpecial(m.Mode) {
+			count(merkletrie.Delete, name)
+		}
+	}
+
+	sort.Slice(s.Roots, func(i, j int) bool {
+		return s.Roots[i].Path < s.Roots[j].Path
+	})
+
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i][2:] < paths[j][2:]
+	})
+
+	if len(paths) > maxTopPaths {
+		paths, s.More = paths[:maxTopPaths], len(paths)-maxTopPaths
+	}
+	s.Top = paths
+
+	return s, nil
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"golang.org/x/sys/unix"
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+type MessageSuite struct {
+	homeFixture
+}
+
+var _ = Suite(&MessageSuite{})
+
+func (s *MessageSuite) TestDefaultMessageTemplate(c *C) {
+	t, err := template.New("message").Parse(defaultMessageTemplate)
+	c.Assert(err, IsNil)
+
+	var msg bytes.Buffer
+	err = t.Execute(&msg, &changeSummary{
+		Trigger: TriggerCron,
+		Host:    "box",
+		Added:   1,
+		Deleted: 11,
+		Roots: []*rootSummary{
+			{Path: "/etc", Added: 1},
+			{Path: "/home", Deleted: 11},
+		},
+		Top:  []string{"A /etc/hosts", "D /home/a"},
+		More: 10,
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(msg.String(), Equals, `cron snapshot of box: 1 added, 0 modified, 11 deleted
+
+/etc: 1 added, 0 modified, 0 deleted
+/home: 0 added, 0 modified, 11 deleted
+
+A /etc/hosts
+D /home/a
+... and 10 more
+`)
+}
+
+func (s *MessageSuite) TestSummarizeChanges(c *C) {
+	w, dir := newTestWorktree(c)
+	w.repo.config.Paths = append(w.repo.config.Paths,
+		pathConfig{Path: dir, Special: specialMetadata})
+	w.repo.config.MessageTemplate = "{{.Trigger}}: {{.Added}} added, {{.Modified}} modified, {{.Deleted}} deleted{{range .Top}}\n{{.}}{{end}}"
+	w.SetTrigger(TriggerCron)
+
+	for _, name := range []string{"a", "b", "c"} {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644), IsNil)
+	}
+	snapshot(c, w, dir)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "a"), []byte("changed"), 0644), IsNil)
+	c.Assert(os.Chmod(filepath.Join(dir, "b"), 0600), IsNil)
+	c.Assert(os.Remove(filepath.Join(dir, "c")), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "d"), []byte("d"), 0644), IsNil)
+	c.Assert(unix.Mkfifo(filepath.Join(dir, "fifo"), 0644), IsNil)
+
+	_, err := w.Add(dir)
+	c.Assert(err, IsNil)
+	h, err := w.Commit("", &git.CommitOptions{
+		Author: &object.Signature{Name: "gimini", Email: "gimini@acme.com", When: time.Now()},
+	})
+	c.Assert(err, IsNil)
+
+	commit, err := w.repo.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, `cron: 2 added, 2 modified, 1 deleted
+M `+filepath.Join(dir, "a")+`
+M `+filepath.Join(dir, "b")+`
+D `+filepath.Join(dir, "c")+`
+A `+filepath.Join(dir, "d")+`
+A `+filepath.Join(dir, "fifo")+`
+`)
+}
@@ -0,0 +1,290 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// metadataPath is the file, inside the repo, holding the metadata of the
+// files in the index until they are committed.
+const metadataPath string = "/metadata"
+
+// sidecarDir is the directory of the root tree of every commit holding the
+// objects describing the snapshot, next to the tracked files.
+const sidecarDir = ".gimini"
+
+// metadataName is the path, in the trees, of the metadata sidecar.
+const metadataName = sidecarDir + "/metadata"
+
+// isSidecar returns whether the path of the trees belongs to the sidecar.
+func isSidecar(name string) bool {
+	return name == sidecarDir || strings.HasPrefix(name, sidecarDir+"/")
+}
+
+// fileMetadata is the metadata of a file git trees have no room for.
+type fileMetadata struct {
+	// Mode is the full os.FileMode, with the setuid, setgid and sticky
+	// bits and the permissions of group and others.
+	Mode    os.FileMode `json:"mode"`
+	UID     uint32      `json:"uid"`
+	GID     uint32      `json:"gid"`
+	ModTime int64       `json:"mtime"`
+	// Xattrs are the extended attributes, ACLs and security labels
+	// included.
+	Xattrs map[string][]byte `json:"xattrs,omitempty"`
+	// Dev and Ino identify the inode of files with more than one link.
+	Dev uint64 `json:"dev,omitempty"`
+	Ino uint64 `json:"ino,omitempty"`
+	// Rdev is the device number of device nodes.
+	Rdev uint64 `json:"rdev,omitempty"`
+	// Link is the path of the file this one is a hard link to, the first of
+	// its link group in the snapshot.
+	Link string `json:"link,omitempty"`
+}
+
+// newFileMetadata returns the metadata of the file at the system path,
+// described by fi.
+func newFileMetadata(path string, fi os.FileInfo) (*fileMetadata, error) {
+	m := &fileMetadata{
+		Mode:    fi.Mode(),
+		ModTime: fi.ModTime().UnixNano(),
+	}
+
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		m.UID = st.Uid
+		m.GID = st.Gid
+
+		if fi.Mode()&os.ModeDevice != 0 {
+			m.Rdev = uint64(st.Rdev)
+		}
+
+		if !fi.IsDir() && st.Nlink > 1 {
+			m.Dev = uint64(st.Dev)
+			m.Ino = uint64(st.Ino)
+		}
+	}
+
+	var err error
+	// fi is the one of the file followed symlinks point to
+	m.Xattrs, err = readXattrs(path, fi.Mode()&os.ModeSymlink == 0)
+	return m, err
+}
+
+// changed returns whether the metadata differs from other in a way status
+// reports, the modification time is only recorded.
+func (m *fileMetadata) changed(other *fileMetadata) bool {
+	return m.Mode != other.Mode || m.UID != other.UID || m.GID != other.GID ||
+		m.Rdev != other.Rdev || !equalXattrs(m.Xattrs, other.Xattrs)
+}
+
+// isMetadataOnly returns whether the file is recorded by its metadata alone,
+// with no index entry, like directories and special files.
+func (m *fileMetadata) isMetadataOnly() bool {
+	return m.Mode.IsDir() || isSpecial(m.Mode)
+}
+
+// metadata is the metadata of a snapshot, by path in the trees.
+type metadata map[string]*fileMetadata
+
+func decodeMetadata(data []byte) (metadata, error) {
+	m := make(metadata)
+	if len(data) == 0 {
+		return m, nil
+	}
+
+	return m, json.Unmarshal(data, &m)
+}
+
+// stagedMetadata returns the metadata of the files in the index.
+func (r *Repository) stagedMetadata() (metadata, error) {
+	data, err := ioutil.ReadFile(r.path + metadataPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return decodeMetadata(data)
+}
+
+func (r *Repository) setStagedMetadata(m metadata) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path+metadataPath, data, 0644)
+}
+
+// commitMetadata returns the metadata stored in the commit, empty for commits
+// made before metadata was recorded.
+func (r *Repository) commitMetadata(commit plumbing.Hash) (metadata, error) {
+	if commit.IsZero() {
+		return make(metadata), nil
+	}
+
+	c, err := r.CommitObject(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return treeMetadata(tree)
+}
+
+// treeMetadata returns the metadata stored in the tree, empty for the trees
+// of commits made before metadata was recorded.
+func treeMetadata(tree *object.Tree) (metadata, error) {
+	f, err := tree.File(metadataName)
+	if err == object.ErrFileNotFound {
+		return make(metadata), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := f.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeMetadata([]byte(data))
+}
+
+// directories returns the paths of the directories, sorted.
+func (m metadata) directories() []string {
+	var dirs []string
+	for name, fm := range m {
+		if fm.Mode.IsDir() {
+			dirs = append(dirs, name)
+		}
+	}
+
+	sort.Strings(dirs)
+	return dirs
+}
+
+// special returns the paths of the special files, sorted.
+func (m metadata) special() []string {
+	var names []string
+	for name, fm := range m {
+		if isSpecial(fm.Mode) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// snapshotMetadata returns the staged metadata of the files in the index and
+// of the files recorded by their metadata alone.
+func (w *Worktree) snapshotMetadata(idx *index.Index) (metadata, error) {
+	staged, err := w.repo.stagedMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(metadata)
+	for _, e := range idx.Entries {
+		if fm, ok := staged[e.Name]; ok {
+			m[e.Name] = fm
+		}
+	}
+
+	for name, fm := range staged {
+		if fm.isMetadataOnly() {
+			m[name] = fm
+		}
+	}
+
+	m.linkGroups()
+	return m, nil
+}
+
+// linkGroups points every file sharing its inode with another one to the
+// first of them.
+func (m metadata) linkGroups() {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	first := make(map[inode]string)
+	for _, name := range names {
+		fm := m[name]
+		if fm.Ino == 0 {
+			continue
+		}
+
+		key := inode{fm.Dev, fm.Ino}
+		if link, ok := first[key]; ok {
+			linked := *fm
+			linked.Link = link
+			m[name] = &linked
+			continue
+		}
+
+		first[key] = name
+	}
+}
+
+// buildMetadataEntry stores the metadata as a blob and returns the index
+// entry placing it in the sidecar of the tree.
+func (w *Worktree) buildMetadataEntry(m metadata) (*index.Entry, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := w.repo.storeBlob(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &index.Entry{Name: metadataName, Hash: h, Mode: filemode.Regular}, nil
+}
+
+// applyMetadata sets the ownership, permissions, extended attributes and
+// modification time of the restored file at the system path. Ownership is
+// only restored when running as root. The os package is used directly since
+// osfs does not implement billy.Change.
+func applyMetadata(path string, m *fileMetadata) error {
+	if os.Geteuid() == 0 {
+		if err := os.Lchown(path, int(m.UID), int(m.GID)); err != nil {
+			return err
+		}
+	}
+
+	if m.Mode&os.ModeSymlink != 0 {
+		return applyXattrs(path, m.Xattrs, false)
+	}
+
+	// set after the ownership, which clears the setuid and setgid bits,
+	// and before the ACLs, which take precedence over the group bits
+	if err := os.Chmod(path, m.Mode); err != nil {
+		return err
+	}
+
+	if err := applyXattrs(path, m.Xattrs, true); err != nil {
+		return err
+	}
+
+	mtime := time.Unix(0, m.ModTime)
+	return os.Chtimes(path, mtime, mtime)
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	. "gopkg.in/check.v1"
+)
+
+type MetadataSuite struct {
+	homeFixture
+}
+
+var _ = Suite(&MetadataSuite{})
+
+func (s *MetadataSuite) TestRestoreMetadata(c *C) {
+	if os.Geteuid() != 0 {
+		c.Skip("changing the owner of files needs root")
+	}
+
+	w, dir := newTestWorktree(c)
+
+	file := filepath.Join(dir, "file")
+	mtime := time.Date(2019, 3, 2, 12, 30, 0, 0, time.UTC)
+	c.Assert(ioutil.WriteFile(file, []byte("foo"), 0644), IsNil)
+	c.Assert(os.Chown(file, 1234, 5678), IsNil)
+	c.Assert(os.Chmod(file, 0640|os.ModeSetgid), IsNil)
+	c.Assert(os.Chtimes(file, mtime, mtime), IsNil)
+
+	commit := snapshot(c, w, dir)
+
+	c.Assert(os.Remove(file), IsNil)
+	c.Assert(w.Restore(commit, file), IsNil)
+
+	fi, err := os.Lstat(file)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode(), Equals, 0640|os.ModeSetgid)
+	c.Assert(fi.ModTime().Equal(mtime), Equals, true)
+
+	st := fi.Sys().(*syscall.Stat_t)
+	c.Assert(st.Uid, Equals, uint32(1234))
+	c.Assert(st.Gid, Equals, uint32(5678))
+}
+
+// posixACL encodes the ACL entries, tag, permissions and id each, the way
+// Linux stores them in the system.posix_acl_access attribute.
+func posixACL(entries ...[3]uint32) []byte {
+	buf := make([]byte, 4, 4+8*len(entries))
+	binary.LittleEndian.PutUint32(buf, 2)
+	for _, e := range entries {
+		var b [8]byte
+		binary.LittleEndian.PutUint16(b[0:], uint16(e[0]))
+		binary.LittleEndian.PutUint16(b[2:], uint16(e[1]))
+		binary.LittleEndian.PutUint32(b[4:], e[2])
+		buf = append(buf, b[:]...)
+	}
+
+	return buf
+}
+
+func (s *MetadataSuite) TestRestoreXattrs(c *C) {
+	w, dir := newTestWorktree(c)
+
+	file := filepath.Join(dir, "file")
+	c.Assert(ioutil.WriteFile(file, []byte("foo"), 0640), IsNil)
+
+	if err := unix.Lsetxattr(file, "user.origin", []byte("gimini"), 0); isXattrUnsupported(err) {
+		c.Skip("extended attributes are not supported")
+	} else {
+		c.Assert(err, IsNil)
+	}
+
+	// owner rw, user 1234 r, group r, mask r, others none
+	acl := posixACL([3]uint32{0x01, 6, ^uint32(0)}, [3]uint32{0x02, 4, 1234},
+		[3]uint32{0x04, 4, ^uint32(0)}, [3]uint32{0x10, 4, ^uint32(0)}, [3]uint32{0x20, 0, ^uint32(0)})
+	hasACL := unix.Lsetxattr(file, "system.posix_acl_access", acl, 0) == nil
+
+	before, err := readXattrs(file, false)
+	c.Assert(err, IsNil)
+
+	commit := snapshot(c, w, dir)
+
+	c.Assert(os.Remove(file), IsNil)
+	c.Assert(w.Restore(commit, file), IsNil)
+
+	after, err := readXattrs(file, false)
+	c.Assert(err, IsNil)
+	c.Assert(after, DeepEquals, before)
+	c.Assert(string(after["user.origin"]), Equals, "gimini")
+
+	if hasACL {
+		c.Assert(after["system.posix_acl_access"], DeepEquals, acl)
+	}
+}
+
+func (s *MetadataSuite) TestRestoreRemovesXattrs(c *C) {
+	w, dir := newTestWorktree(c)
+
+	file := filepath.Join(dir, "file")
+	c.Assert(ioutil.WriteFile(file, []byte("foo"), 0640), IsNil)
+
+	if err := unix.Lsetxattr(file, "user.origin", []byte("gimini"), 0); isXattrUnsupported(err) {
+		c.Skip("extended attributes are not supported")
+	} else {
+		c.Assert(err, IsNil)
+	}
+
+	commit := snapshot(c, w, dir)
+
+	c.Assert(unix.Lsetxattr(file, "user.added", []byte("later"), 0), IsNil)
+	c.Assert(w.Restore(commit, file), IsNil)
+
+	after, err := readXattrs(file, false)
+	c.Assert(err, IsNil)
+	c.Assert(string(after["user.origin"]), Equals, "gimini")
+	c.Assert(after["user.added"], IsNil)
+}
+
+func (s *MetadataSuite) TestFollowedSymlinkXattrs(c *C) {
+	w, dir := newTestWorktree(c)
+	w.repo.config.Paths = append(w.repo.config.Paths,
+		pathConfig{Path: dir, Symlinks: symlinkFollow})
+
+	target := filepath.Join(c.MkDir(), "target")
+	c.Assert(ioutil.WriteFile(target, []byte("foo"), 0640), IsNil)
+
+	if err := unix.Setxattr(target, "user.origin", []byte("gimini"), 0); isXattrUnsupported(err) {
+		c.Skip("extended attributes are not supported")
+	} else {
+		c.Assert(err, IsNil)
+	}
+
+	link := filepath.Join(dir, "link")
+	c.Assert(os.Symlink(target, link), IsNil)
+
+	commit := snapshot(c, w, dir)
+
+	m, err := w.repo.commitMetadata(commit)
+	c.Assert(err, IsNil)
+	c.Assert(m[treePath(link)], NotNil)
+	c.Assert(string(m[treePath(link)].Xattrs["user.origin"]), Equals, "gimini")
+
+	c.Assert(unix.Setxattr(target, "user.origin", []byte("changed"), 0), IsNil)
+	c.Assert(w.Restore(commit, link), IsNil)
+
+	after, err := readXattrs(link, true)
+	c.Assert(err, IsNil)
+	c.Assert(string(after["user.origin"]), Equals, "gimini")
+}
+
+func (s *MetadataSuite) TestRestoreEmptyDirectories(c *C) {
+	w, dir := newTestWorktree(c)
+
+	empty, nested := filepath.Join(dir, "empty"), filepath.Join(dir, "a", "b")
+	c.Assert(os.Mkdir(empty, 0700), IsNil)
+	c.Assert(os.MkdirAll(nested, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "file"), []byte("foo"), 0644), IsNil)
+
+	commit := snapshot(c, w, dir)
+
+	c.Assert(os.Remove(empty), IsNil)
+	c.Assert(os.RemoveAll(filepath.Join(dir, "a")), IsNil)
+	c.Assert(w.Restore(commit, dir), IsNil)
+
+	fi, err := os.Lstat(empty)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode(), Equals, os.ModeDir|0700)
+
+	fi, err = os.Lstat(nested)
+	c.Assert(err, IsNil)
+	c.Assert(fi.IsDir(), Equals, true)
+}
+
+func (s *MetadataSuite) TestRestoreHardLinks(c *C) {
+	w, dir := newTestWorktree(c)
+
+	foo, bar := filepath.Join(dir, "foo"), filepath.Join(dir, "sub", "bar")
+	c.Assert(ioutil.WriteFile(foo, []byte("foo"), 0644), IsNil)
+	c.Assert(os.Mkdir(filepath.Dir(bar), 0755), IsNil)
+	c.Assert(os.Link(foo, bar), IsNil)
+
+	commit := snapshot(c, w, dir)
+
+	c.Assert(os.Remove(foo), IsNil)
+	c.Assert(os.Remove(bar), IsNil)
+	c.Assert(w.Restore(commit, dir), IsNil)
+
+	a, err := os.Lstat(foo)
+	c.Assert(err, IsNil)
+	b, err := os.Lstat(bar)
+	c.Assert(err, IsNil)
+	c.Assert(os.SameFile(a, b), Equals, true)
+	c.Assert(uint64(a.Sys().(*syscall.Stat_t).Nlink), Equals, uint64(2))
+
+	data, err := ioutil.ReadFile(bar)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "foo")
+}
@@ -0,0 +1,300 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// ErrEmptyKeepPolicy is returned when pruning with a policy keeping nothing
+// but the last snapshot of every branch.
+var ErrEmptyKeepPolicy = errors.New("the keep policy is empty, it would only keep the last snapshots")
+
+// KeepPolicy tells which snapshots prune keeps: the last snapshot of each of
+// the last Hourly hours having one, of the last Daily days, and so on. The
+// last snapshot of a branch is always kept.
+type KeepPolicy struct {
+	Hourly  int `yaml:"hourly,omitempty"`
+	Daily   int `yaml:"daily,omitempty"`
+	Weekly  int `yaml:"weekly,omitempty"`
+	Monthly int `yaml:"monthly,omitempty"`
+	Yearly  int `yaml:"yearly,omitempty"`
+}
+
+// KeepPolicy returns the keep policy of the config.
+func (r *Repository) KeepPolicy() KeepPolicy {
+	return r.config.Keep
+}
+
+func (p KeepPolicy) isEmpty() bool {
+	return p == KeepPolicy{}
+}
+
+// period is a kind of time span snapshots are kept by.
+type period struct {
+	keep   int
+	bucket func(t time.Time) string
+}
+
+func (p KeepPolicy) periods() []period {
+	return []period{
+		{p.Hourly, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{p.Yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+}
+
+// keep returns the commits to keep, out of the given ones sorted from the
+// newest to the oldest.
+func (p KeepPolicy) keep(commits []*object.Commit) map[plumbing.Hash]bool {
+	keep := make(map[plumbing.Hash]bool)
+	if len(commits) == 0 {
+		return keep
+	}
+
+	keep[commits[0].Hash] = true
+
+	for _, period := range p.periods() {
+		seen := make(map[string]bool)
+		for _, c := range commits {
+			if len(seen) == period.keep {
+				break
+			}
+
+			b := period.bucket(c.Committer.When.Local())
+			if !seen[b] {
+				seen[b] = true
+				keep[c.Hash] = true
+			}
+		}
+	}
+
+	return keep
+}
+
+// PruneResult tells what a prune removed, or would remove when dry running.
+type PruneResult struct {
+	// Removed are the snapshots removed, by branch.
+	Removed map[string][]*object.Commit
+	GCResult
+}
+
+// Prune removes the snapshots the policy does not keep from every branch,
+// each branch being the history of a host, and collects the objects they
+// leave unreachable. Tagged snapshots are always kept. The kept snapshots
+// are rewritten on top of each other, so their hashes change and the tags
+// follow them, and the remaining objects are repacked. When dry
+// running nothing is changed and the result tells what would be removed.
+func (r *Repository) Prune(policy KeepPolicy, dryRun bool) (*PruneResult, error) {
+	if policy.isEmpty() {
+		return nil, ErrEmptyKeepPolicy
+	}
+
+	res := &PruneResult{Removed: make(map[string][]*object.Commit)}
+	kept := make(map[plumbing.ReferenceName][]plumbing.Hash)
+	rewritten := make(map[plumbing.Hash]plumbing.Hash)
+
+	tagged, err := r.taggedCommits()
+	if err != nil {
+		return nil, err
+	}
+
+	branches, err := r.Branches()
+	if err != nil {
+		return nil, err
+	}
+
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		commits, err := r.firstParents(ref.Hash())
+		if err != nil {
+			return err
+		}
+
+		keep := policy.keep(commits)
+		for h := range tagged {
+			keep[h] = true
+		}
+
+		var keptCommits []*object.Commit
+		for _, c := range commits {
+			if keep[c.Hash] {
+				keptCommits = append(keptCommits, c)
+				kept[ref.Name()] = append(kept[ref.Name()], c.Hash)
+			} else {
+				res.Removed[ref.Name().Short()] = append(res.Removed[ref.Name().Short()], c)
+			}
+		}
+
+		if len(keptCommits) == len(commits) {
+			return nil
+		}
+
+		return r.rewriteBranch(ref.Name(), keptCommits, rewritten, dryRun)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	l := r.newLiveSet()
+	if dryRun {
+		err = l.markPrunedRefs(kept, rewritten)
+	} else if err = r.retargetTags(rewritten); err == nil {
+		err = l.markRefs()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.markIndex(); err != nil {
+		return nil, err
+	}
+
+	gc, err := r.collectGarbage(l, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	res.GCResult = *gc
+	return res, nil
+}
+
+// firstParents returns the commit and its first parents, from the newest to
+// the oldest.
+func (r *Repository) firstParents(h plumbing.Hash) ([]*object.Commit, error) {
+	var commits []*object.Commit
+	for {
+		c, err := r.CommitObject(h)
+		if err != nil {
+			return nil, err
+		}
+
+		commits = append(commits, c)
+		if len(c.ParentHashes) == 0 {
+			return commits, nil
+		}
+
+		h = c.ParentHashes[0]
+	}
+}
+
+// rewriteBranch points the branch to the given commits, sorted from the
+// newest to the oldest, chained on top of each other. The oldest ones which
+// already are keep their hashes, the new hashes of the others are recorded
+// in rewritten. When dry running the new hashes are only computed.
+func (r *Repository) rewriteBranch(name plumbing.ReferenceName, commits []*object.Commit, rewritten map[plumbing.Hash]plumbing.Hash, dryRun bool) error {
+	var parent plumbing.Hash
+	for i := len(commits) - 1; i >= 0; i-- {
+		c := *commits[i]
+
+		var parents []plumbing.Hash
+		if !parent.IsZero() {
+			parents = []plumbing.Hash{parent}
+		}
+
+		if isSameParents(c.ParentHashes, parents) {
+			parent = c.Hash
+			continue
+		}
+
+		c.ParentHashes = parents
+		c.PGPSignature = ""
+
+		obj := r.Storer.NewEncodedObject()
+		if err := c.Encode(obj); err != nil {
+			return err
+		}
+
+		h := obj.Hash()
+		if !dryRun {
+			if _, err := r.Storer.SetEncodedObject(obj); err != nil {
+				return err
+			}
+		}
+
+		rewritten[commits[i].Hash] = h
+		parent = h
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	return r.Storer.SetReference(plumbing.NewHashReference(name, parent))
+}
+
+// markPrunedRefs marks the objects the references reach once the branches
+// are rewritten to the kept commits, and the tags retargeted. The commits
+// rewritten and the annotated tags of them are replaced by new objects, so
+// only their trees are marked. Every other reference reaches what it did.
+func (l *liveSet) markPrunedRefs(kept map[plumbing.ReferenceName][]plumbing.Hash, rewritten map[plumbing.Hash]plumbing.Hash) error {
+	// marked first, so the tags stop at their kept target like retargetTags
+	// leaves them
+	for _, commits := range kept {
+		for _, h := range commits {
+			if _, ok := rewritten[h]; !ok {
+				if err := l.markCommit(h, false); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			c, err := l.r.CommitObject(h)
+			if err != nil {
+				return err
+			}
+
+			if err := l.markTree(c.TreeHash); err != nil {
+				return err
+			}
+		}
+	}
+
+	refs, err := l.r.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		if _, ok := kept[ref.Name()]; ok || ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		target := ref.Hash()
+		if t, err := l.r.TagObject(target); err == nil {
+			target = t.Target
+		} else if err != plumbing.ErrObjectNotFound {
+			return err
+		}
+
+		if _, ok := rewritten[target]; ok {
+			return nil
+		}
+
+		return l.markObject(ref.Hash())
+	})
+}
+
+func isSameParents(a, b []plumbing.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
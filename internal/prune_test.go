@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+type PruneSuite struct {
+	homeFixture
+}
+
+var _ = Suite(&PruneSuite{})
+
+func (s *PruneSuite) TestKeep(c *C) {
+	at := func(i int, when string) *object.Commit {
+		t, err := time.ParseInLocation("2006-01-02 15:04", when, time.Local)
+		c.Assert(err, IsNil)
+
+		return &object.Commit{
+			Hash:      plumbing.ComputeHash(plumbing.CommitObject, []byte{byte(i)}),
+			Committer: object.Signature{When: t},
+		}
+	}
+
+	commits := []*object.Commit{
+		at(0, "2019-03-02 12:30"),
+		at(1, "2019-03-02 12:10"),
+		at(2, "2019-03-02 11:50"),
+		at(3, "2019-03-01 18:00"),
+		at(4, "2019-02-27 09:00"),
+		at(5, "2018-12-31 23:00"),
+	}
+
+	keep := KeepPolicy{Hourly: 2, Daily: 3, Yearly: 2}.keep(commits)
+
+	var kept []int
+	for i, commit := range commits {
+		if keep[commit.Hash] {
+			kept = append(kept, i)
+		}
+	}
+
+	c.Assert(kept, DeepEquals, []int{0, 2, 3, 4, 5})
+}
+
+func (s *PruneSuite) TestKeepLast(c *C) {
+	commit := &object.Commit{Hash: plumbing.ComputeHash(plumbing.CommitObject, nil)}
+
+	keep := KeepPolicy{Daily: 1}.keep([]*object.Commit{commit})
+	c.Assert(keep[commit.Hash], Equals, true)
+}
+
+// snapshots commits the given contents of a file, one snapshot a day
+// from 2019-01-01, returning the snapshots from the oldest to the newest.
+func snapshots(c *C, w *Worktree, dir string, contents ...string) []plumbing.Hash {
+	file := filepath.Join(dir, "file")
+	start := time.Date(2019, 1, 1, 12, 0, 0, 0, time.Local)
+
+	var commits []plumbing.Hash
+	for i, content := range contents {
+		c.Assert(ioutil.WriteFile(file, []byte(content), 0644), IsNil)
+		commits = append(commits, snapshotAt(c, w, dir, start.AddDate(0, 0, i)))
+	}
+
+	return commits
+}
+
+// ageObjects makes the loose objects old enough for gc to remove them.
+func ageObjects(c *C, r *Repository) {
+	past := time.Now().Add(-2 * looseObjectTime)
+	err := filepath.Walk(filepath.Join(r.path, "objects"), func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+
+		return os.Chtimes(path, past, past)
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *PruneSuite) TestPruneDryRun(c *C) {
+	w, dir := newTestWorktree(c)
+
+	commits := snapshots(c, w, dir, "foo", "bar", "baz", "qux")
+	c.Assert(w.repo.CreateTag("bar", commits[1], ""), IsNil)
+	ageObjects(c, w.repo)
+
+	policy := KeepPolicy{Daily: 1}
+	dry, err := w.repo.Prune(policy, true)
+	c.Assert(err, IsNil)
+
+	res, err := w.repo.Prune(policy, false)
+	c.Assert(err, IsNil)
+
+	c.Assert(res.Removed["master"], HasLen, 2)
+	c.Assert(res.Objects, Not(Equals), 0)
+	c.Assert(dry.Objects, Equals, res.Objects)
+	c.Assert(dry.Size, Equals, res.Size)
+	c.Assert(dry.Removed, DeepEquals, res.Removed)
+}
+
+func (s *PruneSuite) TestPruneRewritesBranch(c *C) {
+	w, dir := newTestWorktree(c)
+
+	commits := snapshots(c, w, dir, "foo", "bar", "baz", "qux")
+	c.Assert(w.repo.CreateTag("foo", commits[0], ""), IsNil)
+
+	var trees []plumbing.Hash
+	for _, h := range []plumbing.Hash{commits[3], commits[2], commits[0]} {
+		commit, err := w.repo.CommitObject(h)
+		c.Assert(err, IsNil)
+		trees = append(trees, commit.TreeHash)
+	}
+
+	_, err := w.repo.Prune(KeepPolicy{Daily: 2}, false)
+	c.Assert(err, IsNil)
+
+	head, err := w.repo.Head()
+	c.Assert(err, IsNil)
+	kept, err := w.repo.firstParents(head.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(kept, HasLen, len(trees))
+
+	for i, commit := range kept {
+		c.Assert(commit.TreeHash, Equals, trees[i])
+	}
+
+	file := filepath.Join(dir, "file")
+	for i, content := range []string{"qux", "baz", "foo"} {
+		c.Assert(w.Restore(kept[i].Hash, file), IsNil)
+
+		data, err := ioutil.ReadFile(file)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, content)
+	}
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+)
+
+// Report lists what could not be snapshotted as asked. Errors reading a path
+// leave it out, or unchanged in the index, and the walk goes on with the
+// rest; the snapshot is then partial.
+type Report struct {
+	Errors   []error
+	Warnings []string
+
+	// Excluded are the files left out on purpose, by the reason why.
+	Excluded map[string]string
+
+	failed map[string]bool
+}
+
+// Partial returns whether some paths could not be read.
+func (r *Report) Partial() bool {
+	return len(r.Errors) != 0
+}
+
+func (r *Report) warn(format string, a ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, a...))
+}
+
+func (r *Report) exclude(path, reason string) {
+	if r.Excluded == nil {
+		r.Excluded = make(map[string]string)
+	}
+
+	r.Excluded[path] = reason
+}
+
+// fail records the error reading the file at path, once per path.
+func (r *Report) fail(path string, err error) {
+	if r.failed[path] {
+		return
+	}
+
+	if r.failed == nil {
+		r.failed = make(map[string]bool)
+	}
+
+	r.failed[path] = true
+	r.Errors = append(r.Errors, err)
+}
+
+// isReadError returns whether err comes from reading the system file at path
+// or below it, rather than from the repository.
+func isReadError(path string, err error) bool {
+	pe, ok := err.(*os.PathError)
+	return ok && isBelowAny(pe.Path, []string{path})
+}
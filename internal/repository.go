@@ -1,21 +1,34 @@
 package internal
 
 import (
-  "os"
+	"io"
+	"os"
+	"strings"
 
 	"gopkg.in/src-d/go-billy.v4/osfs"
 
 	"gopkg.in/src-d/go-git.v4"
-	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+
+	"github.com/WhoMeNope/gimini/internal/utils/annex"
 )
 
 const repoPath string = "/.gimini"
 
+// annexPath is the directory of the local annex store, inside the repo.
+const annexPath string = "/annex"
+
 type Repository struct {
   git.Repository
 
   config config
+  annex  *annex.Store
+  path   string
 }
 
 func OpenOrInit() (*Repository, error) {
@@ -47,6 +60,97 @@ func OpenOrInit() (*Repository, error) {
 	}
   config.save()
 
-  return &Repository{*plainRepo, config}, nil
+  return &Repository{*plainRepo, config, annex.NewStore(osfs.New(repoPathFull + annexPath)), repoPathFull}, nil
+}
+
+// annexRemote returns the store annexed content is copied to, nil if no
+// remote is configured.
+func (r *Repository) annexRemote() *annex.Store {
+	if r.config.AnnexRemote == "" {
+		return nil
+	}
+
+	return annex.NewStore(osfs.New(r.config.AnnexRemote))
+}
+
+
+// ResolveCommit returns the hash of the commit the given revision points to,
+// tag names included.
+func (r *Repository) ResolveCommit(rev string) (plumbing.Hash, error) {
+	// go-git peels a single level of annotated tags
+	if ref, err := r.Tag(rev); err == nil {
+		return r.peelTag(ref.Hash())
+	}
+
+	h, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return *h, nil
 }
 
+// walkFiles calls fn with the system path and the tree entry of every file of
+// the commit at or below the given paths, all of them if no path is given.
+func (r *Repository) walkFiles(commit plumbing.Hash, paths []string, fn func(path string, entry object.TreeEntry) error) error {
+	c, err := r.CommitObject(commit)
+	if err != nil {
+		return err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return err
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if entry.Mode == filemode.Dir || isSidecar(name) || !isBelowAny(systemPath(name), paths) {
+			continue
+		}
+
+		if err := fn(systemPath(name), entry); err != nil {
+			return err
+		}
+	}
+}
+
+// Show writes the content of the file at the given system path, as it was
+// stored in the commit, to dst.
+func (r *Repository) Show(commit plumbing.Hash, path string, dst io.Writer) (err error) {
+	c, err := r.CommitObject(commit)
+	if err != nil {
+		return err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return err
+	}
+
+	f, err := tree.File(strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return err
+	}
+
+	src, err := r.openBlob(f.Hash)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(src, &err)
+
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"os"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// homeFixture puts back the home directory newTestWorktree replaces, after
+// every test of the suites embedding it.
+type homeFixture struct {
+	home string
+	set  bool
+}
+
+func (f *homeFixture) SetUpTest(c *C) {
+	f.home, f.set = os.LookupEnv("HOME")
+}
+
+func (f *homeFixture) TearDownTest(c *C) {
+	if f.set {
+		c.Assert(os.Setenv("HOME", f.home), IsNil)
+	} else {
+		c.Assert(os.Unsetenv("HOME"), IsNil)
+	}
+}
+
+// newTestWorktree returns the worktree of a new repository, in a temporary
+// directory used as the home directory for the rest of the test, along with
+// a temporary directory to snapshot. Suites calling it embed homeFixture.
+func newTestWorktree(c *C) (*Worktree, string) {
+	c.Assert(os.Setenv("HOME", c.MkDir()), IsNil)
+
+	repo, err := OpenOrInit()
+	c.Assert(err, IsNil)
+
+	w, err := GetWorktree(repo)
+	c.Assert(err, IsNil)
+
+	return &w, c.MkDir()
+}
+
+// snapshot adds the path and commits it, returning the commit.
+func snapshot(c *C, w *Worktree, path string) plumbing.Hash {
+	return snapshotAt(c, w, path, time.Now())
+}
+
+// snapshotAt adds the path and commits it as made at the given time,
+// returning the commit.
+func snapshotAt(c *C, w *Worktree, path string, when time.Time) plumbing.Hash {
+	_, err := w.Add(path)
+	c.Assert(err, IsNil)
+
+	h, err := w.Commit("snapshot", &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "gimini",
+			Email: "gimini@acme.com",
+			When:  when,
+		},
+	})
+	c.Assert(err, IsNil)
+
+	return h
+}
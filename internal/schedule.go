@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// schedulePath is the file, inside the repo, holding when each scheduled
+// path was last snapshotted.
+const schedulePath string = "/schedule"
+
+// scheduleSlack is how early a path is due, at most a tenth of its schedule,
+// so that a run starting a bit sooner after the last one than the schedule,
+// as cron does, still snapshots it.
+const scheduleSlack = time.Minute
+
+// schedule is how often a tracked path is snapshotted by run-scheduled,
+// written in the config as hourly, daily, weekly or a duration such as 30m.
+type schedule time.Duration
+
+var scheduleNames = map[string]schedule{
+	"hourly": schedule(time.Hour),
+	"daily":  schedule(24 * time.Hour),
+	"weekly": schedule(7 * 24 * time.Hour),
+}
+
+func parseSchedule(s string) (schedule, error) {
+	if sc, ok := scheduleNames[s]; ok {
+		return sc, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid schedule %q", s)
+	}
+
+	return schedule(d), nil
+}
+
+func (s schedule) String() string {
+	for name, sc := range scheduleNames {
+		if s == sc {
+			return name
+		}
+	}
+
+	return time.Duration(s).String()
+}
+
+func (s *schedule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+
+	sc, err := parseSchedule(str)
+	if err != nil {
+		return err
+	}
+
+	*s = sc
+	return nil
+}
+
+func (s schedule) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// DuePaths returns the tracked paths with a schedule which are due at now,
+// the ones never snapshotted by run-scheduled included.
+func (r *Repository) DuePaths(now time.Time) ([]string, error) {
+	runs, err := r.lastRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, p := range r.config.Paths {
+		if p.Schedule == 0 {
+			continue
+		}
+
+		if !now.Before(nextRun(runs[p.Path], p.Schedule)) {
+			paths = append(paths, p.Path)
+		}
+	}
+
+	return paths, nil
+}
+
+// NextRun returns when the next scheduled path is due, ok is false if no
+// path has a schedule. Paths never snapshotted by run-scheduled are due at
+// the zero time, that is at once.
+func (r *Repository) NextRun() (next time.Time, ok bool, err error) {
+	runs, err := r.lastRuns()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	for _, p := range r.config.Paths {
+		if p.Schedule == 0 {
+			continue
+		}
+
+		if t := nextRun(runs[p.Path], p.Schedule); !ok || t.Before(next) {
+			next, ok = t, true
+		}
+	}
+
+	return next, ok, nil
+}
+
+// nextRun returns when a path last run at last is due, the zero time when it
+// never ran.
+func nextRun(last time.Time, s schedule) time.Time {
+	if last.IsZero() {
+		return last
+	}
+
+	slack := scheduleSlack
+	if d := time.Duration(s) / 10; d < slack {
+		slack = d
+	}
+
+	return last.Add(time.Duration(s) - slack)
+}
+
+// MarkRun records that the paths were snapshotted at t.
+func (r *Repository) MarkRun(paths []string, t time.Time) error {
+	runs, err := r.lastRuns()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		runs[p] = t
+	}
+
+	data, err := json.Marshal(runs)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path+schedulePath, data, 0644)
+}
+
+// lastRuns returns when each scheduled path was last snapshotted.
+func (r *Repository) lastRuns() (map[string]time.Time, error) {
+	runs := make(map[string]time.Time)
+
+	data, err := ioutil.ReadFile(r.path + schedulePath)
+	if os.IsNotExist(err) {
+		return runs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return runs, json.Unmarshal(data, &runs)
+}
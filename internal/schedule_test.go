@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
+)
+
+type ScheduleSuite struct {
+	homeFixture
+}
+
+var _ = Suite(&ScheduleSuite{})
+
+func (s *ScheduleSuite) TestUnmarshalSchedule(c *C) {
+	var cfg config
+	err := yaml.Unmarshal([]byte(`
+paths:
+- path: /etc
+  schedule: hourly
+- path: /home
+  schedule: 90m
+`), &cfg)
+
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Paths[0].Schedule, Equals, schedule(time.Hour))
+	c.Assert(cfg.Paths[1].Schedule, Equals, schedule(90*time.Minute))
+
+	data, err := yaml.Marshal(cfg.Paths)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "- path: /etc\n  schedule: hourly\n- path: /home\n  schedule: 1h30m0s\n")
+
+	err = yaml.Unmarshal([]byte(`
+paths:
+- path: /etc
+  schedule: -1h
+`), &cfg)
+
+	c.Assert(err, ErrorMatches, `invalid schedule "-1h"`)
+}
+
+func (s *ScheduleSuite) TestNextRun(c *C) {
+	last := time.Date(2019, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	c.Assert(nextRun(time.Time{}, scheduleNames["daily"]).IsZero(), Equals, true)
+	c.Assert(nextRun(last, scheduleNames["hourly"]), Equals, last.Add(59*time.Minute))
+	c.Assert(nextRun(last, schedule(10*time.Second)), Equals, last.Add(9*time.Second))
+}
+
+func (s *ScheduleSuite) TestNextRunNewPath(c *C) {
+	w, dir := newTestWorktree(c)
+
+	_, ok, err := w.repo.NextRun()
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+
+	w.repo.config.Paths = append(w.repo.config.Paths,
+		pathConfig{Path: dir, Schedule: scheduleNames["daily"]})
+
+	// never run, it is due at once
+	now := time.Now()
+	next, ok, err := w.repo.NextRun()
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+	c.Assert(next.After(now), Equals, false)
+
+	paths, err := w.repo.DuePaths(now)
+	c.Assert(err, IsNil)
+	c.Assert(paths, DeepEquals, []string{dir})
+
+	c.Assert(w.repo.MarkRun(paths, now), IsNil)
+	next, ok, err = w.repo.NextRun()
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+	c.Assert(next.Equal(nextRun(now, scheduleNames["daily"])), Equals, true)
+}
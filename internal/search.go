@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	filepath "path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// binarySniffLen is how much of a file is looked at for a NUL byte to tell
+// it is binary, as git does.
+const binarySniffLen = 8000
+
+// maxLineLen is the longest line grep reads, the rest of a file with a
+// longer line is skipped.
+const maxLineLen = 1 << 20
+
+// SearchOptions limits a search across the history.
+type SearchOptions struct {
+	// MaxCommits is the number of snapshots searched, the newest of every
+	// branch first, all of them when zero.
+	MaxCommits int
+	// Paths are the system paths the files searched are at or below, all
+	// of them when empty.
+	Paths []string
+	// Binary searches the content of binary files too.
+	Binary bool
+}
+
+// Match is a file, or a line of a file, found in a snapshot.
+type Match struct {
+	Commit *object.Commit
+	// Path is the system path of the file, or the path in the trees of
+	// the output of a command.
+	Path string
+	// Line is the number of the matching line, from 1, zero for files.
+	Line int
+	Text string
+}
+
+// Find calls fn with every version of the files whose path matches the
+// glob, once for the newest snapshot holding it. A glob without a slash is
+// matched against the file names only.
+func (r *Repository) Find(glob string, opts SearchOptions, fn func(Match) error) error {
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return err
+	}
+
+	return r.walkHistory(opts, func(c *object.Commit, name string, e object.TreeEntry) error {
+		target := name
+		if !strings.Contains(glob, "/") {
+			target = filepath.Base(name)
+		}
+
+		if ok, _ := filepath.Match(glob, target); !ok {
+			return nil
+		}
+
+		return fn(Match{Commit: c, Path: name})
+	})
+}
+
+// Grep calls fn with the lines matching the expression of every version of
+// the files, once for the newest snapshot holding it. Symlinks and annexed
+// files are not searched, neither are binary files unless asked.
+func (r *Repository) Grep(re *regexp.Regexp, opts SearchOptions, fn func(Match) error) error {
+	return r.walkHistory(opts, func(c *object.Commit, name string, e object.TreeEntry) error {
+		if e.Mode == filemode.Symlink {
+			return nil
+		}
+
+		if p, err := r.readPointer(e.Hash); err != nil || p != nil {
+			return err
+		}
+
+		return r.grepBlob(e.Hash, re, opts.Binary, func(line int, text string) error {
+			return fn(Match{Commit: c, Path: name, Line: line, Text: text})
+		})
+	})
+}
+
+func (r *Repository) grepBlob(h plumbing.Hash, re *regexp.Regexp, binary bool, fn func(line int, text string) error) (err error) {
+	src, err := r.openBlob(h)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(src, &err)
+
+	br := bufio.NewReaderSize(src, binarySniffLen)
+	head, err := br.Peek(binarySniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+
+	if !binary && bytes.IndexByte(head, 0) != -1 {
+		return nil
+	}
+
+	s := bufio.NewScanner(br)
+	s.Buffer(nil, maxLineLen)
+
+	for line := 1; s.Scan(); line++ {
+		if re.Match(s.Bytes()) {
+			if err := fn(line, s.Text()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.Err() == bufio.ErrTooLong {
+		return nil
+	}
+
+	return s.Err()
+}
+
+// walkHistory calls fn with the files of the snapshots of every branch, the
+// newest first, each version of a file only once. The metadata sidecar is
+// left out but for the output of the commands.
+func (r *Repository) walkHistory(opts SearchOptions, fn func(c *object.Commit, name string, e object.TreeEntry) error) error {
+	commits, err := r.snapshots()
+	if err != nil {
+		return err
+	}
+
+	h := &historyWalker{r: r, paths: opts.Paths, seen: make(map[string]bool), fn: fn}
+
+	for n, c := range commits {
+		if opts.MaxCommits != 0 && n == opts.MaxCommits {
+			return nil
+		}
+
+		tree, err := c.Tree()
+		if err != nil {
+			return err
+		}
+
+		if err := h.walkTree(c, "", tree); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// histories returns the snapshots of every branch, each branch being the
+// history of a host, from the newest to the oldest.
+func (r *Repository) histories() ([][]*object.Commit, error) {
+	branches, err := r.Branches()
+	if err != nil {
+		return nil, err
+	}
+
+	var histories [][]*object.Commit
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		commits, err := r.firstParents(ref.Hash())
+		if err != nil {
+			return err
+		}
+
+		histories = append(histories, commits)
+		return nil
+	})
+
+	return histories, err
+}
+
+// snapshots returns the snapshots of every branch from the newest to the
+// oldest, the ones shared by several branches only once.
+func (r *Repository) snapshots() ([]*object.Commit, error) {
+	histories, err := r.histories()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	var commits []*object.Commit
+	for _, history := range histories {
+		for _, c := range history {
+			if !seen[c.Hash] {
+				seen[c.Hash] = true
+				commits = append(commits, c)
+			}
+		}
+	}
+
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Committer.When.After(commits[j].Committer.When)
+	})
+
+	return commits, nil
+}
+
+type historyWalker struct {
+	r     *Repository
+	paths []string
+	// seen are the paths along with the hash of the tree or blob seen at
+	// them, so that subtrees unchanged since a newer snapshot are skipped
+	seen map[string]bool
+	fn   func(c *object.Commit, name string, e object.TreeEntry) error
+}
+
+func (h *historyWalker) walkTree(c *object.Commit, prefix string, t *object.Tree) error {
+	for _, e := range t.Entries {
+		name := filepath.Join(prefix, e.Name)
+
+		key := name + "\x00" + e.Hash.String()
+		if h.seen[key] {
+			continue
+		}
+		h.seen[key] = true
+
+		switch {
+		case e.Mode == filemode.Dir:
+			sub, err := h.r.TreeObject(e.Hash)
+			if err != nil {
+				return err
+			}
+
+			if err := h.walkTree(c, name, sub); err != nil {
+				return err
+			}
+
+		case e.Mode == filemode.Submodule:
+
+		case strings.HasPrefix(name, commandsDir+"/"):
+			if len(h.paths) == 0 {
+				if err := h.fn(c, name, e); err != nil {
+					return err
+				}
+			}
+
+		case !isSidecar(name) && isBelowAny(systemPath(name), h.paths):
+			if err := h.fn(c, systemPath(name), e); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"path/filepath"
+	"regexp"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+type SearchSuite struct {
+	homeFixture
+}
+
+var _ = Suite(&SearchSuite{})
+
+func (s *SearchSuite) TestGrepBlob(c *C) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	c.Assert(err, IsNil)
+
+	r := &Repository{Repository: *repo}
+
+	text, err := r.storeBlob([]byte("foo\nbar\nfoobar\n"))
+	c.Assert(err, IsNil)
+	bin, err := r.storeBlob([]byte("foo\x00bar"))
+	c.Assert(err, IsNil)
+
+	grep := func(h plumbing.Hash, binary bool) []int {
+		var lines []int
+		err := r.grepBlob(h, regexp.MustCompile("^foo"), binary, func(line int, text string) error {
+			lines = append(lines, line)
+			return nil
+		})
+		c.Assert(err, IsNil)
+		return lines
+	}
+
+	c.Assert(grep(text, false), DeepEquals, []int{1, 3})
+	c.Assert(grep(bin, false), HasLen, 0)
+	c.Assert(grep(bin, true), DeepEquals, []int{1})
+}
+
+func (s *SearchSuite) TestGrepEveryBranch(c *C) {
+	w, dir := newTestWorktree(c)
+
+	commits := snapshots(c, w, dir, "foo\n", "bar\n")
+	first, second := commits[0], commits[1]
+
+	// the second snapshot only is on the branch of another host
+	head, err := w.repo.Head()
+	c.Assert(err, IsNil)
+	c.Assert(w.repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), first)), IsNil)
+	c.Assert(w.repo.Storer.SetReference(plumbing.NewHashReference("refs/heads/other", second)), IsNil)
+
+	var found []plumbing.Hash
+	err = w.repo.Grep(regexp.MustCompile("o|a"), SearchOptions{}, func(m Match) error {
+		c.Assert(m.Path, Equals, filepath.Join(dir, "file"))
+		found = append(found, m.Commit.Hash)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(found, DeepEquals, []plumbing.Hash{second, first})
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	filepath "path"
+
+	"golang.org/x/sys/unix"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+)
+
+// isSpecial returns whether the mode is the one of a socket, FIFO or device
+// node, which have no content git could store.
+func isSpecial(mode os.FileMode) bool {
+	return mode&(os.ModeSocket|os.ModeNamedPipe|os.ModeDevice|os.ModeCharDevice) != 0
+}
+
+// doAddSpecialFile handles the special file at path following the policy of
+// its tracked path. A special file replacing a regular one is removed from
+// the index whatever the policy.
+func (w *Worktree) doAddSpecialFile(idx *index.Index, m metadata, path string) (added bool, err error) {
+	if _, err := idx.Entry(w.indexName(path)); err == nil {
+		if _, err := w.deleteFromIndex(idx, path); err != nil {
+			return false, err
+		}
+
+		added = true
+	}
+
+	p, _ := w.repo.config.trackedPath(path)
+	switch p.Special {
+	case specialFail:
+		return added, fmt.Errorf("%s: special file", path)
+	case specialMetadata:
+		return added, w.updateMetadata(m, path)
+	}
+
+	delete(m, treePath(path))
+	w.report.warn("%s: special file skipped", path)
+	return added, nil
+}
+
+// restoreSpecialFiles recreates the special files recorded in the metadata,
+// at or below the paths, and applies their metadata. Sockets are left for the
+// programs listening on them to create.
+func (w *Worktree) restoreSpecialFiles(m metadata, paths []string) error {
+	for _, name := range m.special() {
+		fm, path := m[name], systemPath(name)
+		if fm.Mode&os.ModeSocket != 0 || !isBelowAny(path, paths) {
+			continue
+		}
+
+		if err := w.systemFilesystem.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := unix.Mknod(path, unixMode(fm.Mode), int(fm.Rdev)); err != nil {
+			return fmt.Errorf("creating %s: %s", path, err)
+		}
+
+		if err := applyMetadata(path, fm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unixMode returns the mode of the special file as mknod takes it.
+func unixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		m |= unix.S_IFIFO
+	case mode&os.ModeCharDevice != 0:
+		m |= unix.S_IFCHR
+	case mode&os.ModeDevice != 0:
+		m |= unix.S_IFBLK
+	}
+
+	if mode&os.ModeSetuid != 0 {
+		m |= unix.S_ISUID
+	}
+
+	if mode&os.ModeSetgid != 0 {
+		m |= unix.S_ISGID
+	}
+
+	if mode&os.ModeSticky != 0 {
+		m |= unix.S_ISVTX
+	}
+
+	return m
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// symlinkPolicy is what Add does with symlinks.
+type symlinkPolicy string
+
+const (
+	// symlinkStore stores symlinks as their target, like git.
+	symlinkStore symlinkPolicy = "store"
+	// symlinkFollow stores the file or directory symlinks point to in
+	// their place.
+	symlinkFollow symlinkPolicy = "follow"
+	// symlinkFollowWithin follows the symlinks pointing to a tracked path,
+	// once both are resolved, and stores the others.
+	symlinkFollowWithin symlinkPolicy = "follow_within"
+)
+
+func (p *symlinkPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	s, err := unmarshalPolicy(unmarshal, "symlink",
+		string(symlinkStore), string(symlinkFollow), string(symlinkFollowWithin))
+
+	*p = symlinkPolicy(s)
+	return err
+}
+
+// unmarshalPolicy unmarshals a string which has to be one of the values.
+func unmarshalPolicy(unmarshal func(interface{}) error, name string, values ...string) (string, error) {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return "", err
+	}
+
+	for _, v := range values {
+		if s == v {
+			return s, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid %s policy %q", name, s)
+}
+
+// followsSymlink returns whether the symlink at the system path is followed,
+// given the config of its tracked path. Tracked paths which are symlinks are
+// always resolved.
+func (c *config) followsSymlink(path string) bool {
+	p, ok := c.trackedPath(path)
+	if !ok {
+		return false
+	}
+
+	switch {
+	case p.Path == path, p.Symlinks == symlinkFollow:
+		return true
+	case p.Symlinks == symlinkFollowWithin:
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return false
+		}
+
+		for _, p := range c.Paths {
+			root, err := filepath.EvalSymlinks(p.Path)
+			if err == nil && isBelowAny(target, []string{root}) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// inode identifies a file.
+type inode struct {
+	dev, ino uint64
+}
+
+func inodeOf(fi os.FileInfo) (inode, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return inode{}, false
+	}
+
+	return inode{uint64(st.Dev), uint64(st.Ino)}, true
+}
+
+// lstat returns the info of the file at the system path, the one of the file
+// it points to when it is a symlink Add follows.
+func (w *Worktree) lstat(path string) (os.FileInfo, error) {
+	fi, _, err := w.resolve(path)
+	return fi, err
+}
+
+// resolve is lstat, also returning whether the symlink at path is not
+// followed because it points to one of the directories above it, which would
+// make the walk loop.
+func (w *Worktree) resolve(path string) (fi os.FileInfo, cycle bool, err error) {
+	fi, err = w.systemFilesystem.Lstat(path)
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 || !w.repo.config.followsSymlink(path) {
+		return fi, false, err
+	}
+
+	target, err := w.systemFilesystem.Stat(path)
+	if err != nil {
+		// dangling, stored as is
+		return fi, false, nil
+	}
+
+	ino, ok := inodeOf(target)
+	if !ok || !target.IsDir() {
+		return target, false, nil
+	}
+
+	for dir := filepath.Dir(path); dir != "/"; dir = filepath.Dir(dir) {
+		parent, err := w.systemFilesystem.Stat(dir)
+		if err != nil {
+			continue
+		}
+
+		if other, ok := inodeOf(parent); ok && other == ino {
+			return fi, true, nil
+		}
+	}
+
+	return target, false, nil
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// TagInfo describes a tag of a snapshot.
+type TagInfo struct {
+	Name    string
+	Commit  plumbing.Hash
+	When    time.Time
+	Message string
+}
+
+// CreateTag marks the snapshot with an annotated tag, the message defaulting
+// to the name of the tag.
+func (r *Repository) CreateTag(name string, commit plumbing.Hash, msg string) error {
+	if msg == "" {
+		msg = name
+	}
+
+	_, err := r.Repository.CreateTag(name, commit, &git.CreateTagOptions{
+		Tagger: &object.Signature{
+			Name:  "gimini",
+			Email: "gimini@acme.com",
+			When:  time.Now(),
+		},
+		Message: msg,
+	})
+
+	return err
+}
+
+// ListTags returns the tags of the snapshots, sorted by name.
+func (r *Repository) ListTags() ([]TagInfo, error) {
+	refs, err := r.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []TagInfo
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		info := TagInfo{Name: ref.Name().Short()}
+
+		if t, err := r.TagObject(ref.Hash()); err == nil {
+			info.When = t.Tagger.When
+			info.Message = strings.TrimSpace(t.Message)
+		}
+
+		commit, err := r.peelTag(ref.Hash())
+		if err != nil {
+			return err
+		}
+		info.Commit = commit
+
+		tags = append(tags, info)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags, nil
+}
+
+// peelTag returns the commit the tag object, or tags of tags, point to, the
+// hash itself when it is not a tag object.
+func (r *Repository) peelTag(h plumbing.Hash) (plumbing.Hash, error) {
+	for {
+		t, err := r.TagObject(h)
+		if err == plumbing.ErrObjectNotFound {
+			return h, nil
+		}
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		h = t.Target
+	}
+}
+
+// taggedCommits returns the commits which are tagged.
+func (r *Repository) taggedCommits() (map[plumbing.Hash]bool, error) {
+	tags, err := r.ListTags()
+	if err != nil {
+		return nil, err
+	}
+
+	tagged := make(map[plumbing.Hash]bool)
+	for _, t := range tags {
+		tagged[t.Commit] = true
+	}
+
+	return tagged, nil
+}
+
+// retargetTags points the tags of the rewritten commits to their new
+// hashes. Annotated tags are rewritten with their new target, without their
+// signature.
+func (r *Repository) retargetTags(rewritten map[plumbing.Hash]plumbing.Hash) error {
+	refs, err := r.Tags()
+	if err != nil {
+		return err
+	}
+
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		target := ref.Hash()
+
+		t, err := r.TagObject(target)
+		if err != nil && err != plumbing.ErrObjectNotFound {
+			return err
+		}
+
+		if t == nil {
+			h, ok := rewritten[target]
+			if !ok {
+				return nil
+			}
+
+			return r.Storer.SetReference(plumbing.NewHashReference(ref.Name(), h))
+		}
+
+		h, ok := rewritten[t.Target]
+		if !ok {
+			return nil
+		}
+
+		tag := *t
+		tag.Target = h
+		tag.PGPSignature = ""
+
+		obj := r.Storer.NewEncodedObject()
+		if err := tag.Encode(obj); err != nil {
+			return err
+		}
+
+		th, err := r.Storer.SetEncodedObject(obj)
+		if err != nil {
+			return err
+		}
+
+		return r.Storer.SetReference(plumbing.NewHashReference(ref.Name(), th))
+	})
+}
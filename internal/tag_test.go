@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+type TagSuite struct{}
+
+var _ = Suite(&TagSuite{})
+
+func (s *TagSuite) TestRetargetTags(c *C) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	c.Assert(err, IsNil)
+
+	r := &Repository{Repository: *repo}
+
+	commit := func(msg string) plumbing.Hash {
+		obj := r.Storer.NewEncodedObject()
+		sig := object.Signature{Name: "gimini", When: time.Now()}
+		c.Assert((&object.Commit{Author: sig, Committer: sig, Message: msg}).Encode(obj), IsNil)
+
+		h, err := r.Storer.SetEncodedObject(obj)
+		c.Assert(err, IsNil)
+		return h
+	}
+
+	old, new := commit("old"), commit("new")
+
+	c.Assert(r.CreateTag("annotated", old, "known good"), IsNil)
+	_, err = r.Repository.CreateTag("light", old, nil)
+	c.Assert(err, IsNil)
+
+	h, err := r.ResolveCommit("annotated")
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, old)
+
+	c.Assert(r.retargetTags(map[plumbing.Hash]plumbing.Hash{old: new}), IsNil)
+
+	tags, err := r.ListTags()
+	c.Assert(err, IsNil)
+	c.Assert(tags, HasLen, 2)
+	c.Assert(tags[0].Name, Equals, "annotated")
+	c.Assert(tags[0].Commit, Equals, new)
+	c.Assert(tags[0].Message, Equals, "known good")
+	c.Assert(tags[1].Name, Equals, "light")
+	c.Assert(tags[1].Commit, Equals, new)
+}
@@ -0,0 +1,112 @@
+package annex
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type AnnexSuite struct{}
+
+var _ = Suite(&AnnexSuite{})
+
+const fooKey = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+func (s *AnnexSuite) TestNewPointer(c *C) {
+	p, err := NewPointer(strings.NewReader("foo"))
+	c.Assert(err, IsNil)
+	c.Assert(p, DeepEquals, &Pointer{Size: 3, Key: fooKey})
+	c.Assert(p.Hash(), Equals, plumbing.ComputeHash(plumbing.BlobObject, p.Bytes()))
+}
+
+func (s *AnnexSuite) TestPointerEncodeDecode(c *C) {
+	p := &Pointer{Size: 3, Key: fooKey}
+
+	var buf bytes.Buffer
+	c.Assert(p.Encode(&buf), IsNil)
+	c.Assert(IsPointer(buf.Bytes()), Equals, true)
+
+	decoded := &Pointer{}
+	c.Assert(decoded.Decode(&buf), IsNil)
+	c.Assert(decoded, DeepEquals, p)
+}
+
+func (s *AnnexSuite) TestPointerDecodeInvalid(c *C) {
+	p := &Pointer{}
+	c.Assert(p.Decode(strings.NewReader("foo")), Equals, ErrInvalidPointer)
+	c.Assert(p.Decode(strings.NewReader(Magic+"size 3\nsha256 foo\n")), Equals, ErrInvalidPointer)
+	c.Assert(p.Decode(strings.NewReader(Magic+"size 3\nsha256 "+fooKey+"\nfoo\n")), Equals, ErrInvalidPointer)
+}
+
+func (s *AnnexSuite) TestIsAnnexed(c *C) {
+	c.Assert(IsAnnexed(10, 0), Equals, false)
+	c.Assert(IsAnnexed(10, 11), Equals, false)
+	c.Assert(IsAnnexed(10, 10), Equals, true)
+}
+
+func (s *AnnexSuite) TestStore(c *C) {
+	st := NewStore(memfs.New())
+
+	p, err := st.Put(strings.NewReader("foo"))
+	c.Assert(err, IsNil)
+	c.Assert(p.Key, Equals, fooKey)
+	c.Assert(st.Has(fooKey), Equals, true)
+
+	p, err = st.Put(strings.NewReader("foo"))
+	c.Assert(err, IsNil)
+	c.Assert(p.Key, Equals, fooKey)
+
+	r, err := st.Open(fooKey)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo")
+	c.Assert(r.Close(), IsNil)
+
+	var keys []string
+	c.Assert(st.ForEach(func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}), IsNil)
+	c.Assert(keys, DeepEquals, []string{fooKey})
+
+	c.Assert(st.Remove(fooKey), IsNil)
+	c.Assert(st.Has(fooKey), Equals, false)
+	c.Assert(st.Remove(fooKey), IsNil)
+}
+
+func (s *AnnexSuite) TestStoreCopy(c *C) {
+	src := NewStore(memfs.New())
+	dst := NewStore(memfs.New())
+
+	_, err := src.Put(strings.NewReader("foo"))
+	c.Assert(err, IsNil)
+
+	c.Assert(dst.Copy(src, fooKey), IsNil)
+	c.Assert(dst.Has(fooKey), Equals, true)
+
+	size, err := dst.Size(fooKey)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(3))
+}
+
+func (s *AnnexSuite) TestStoreVerify(c *C) {
+	fs := memfs.New()
+	st := NewStore(fs)
+
+	_, err := st.Put(strings.NewReader("foo"))
+	c.Assert(err, IsNil)
+	c.Assert(st.Verify(fooKey), IsNil)
+
+	f, err := fs.Create(st.path(fooKey))
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+	c.Assert(st.Verify(fooKey), Equals, ErrCorruptContent)
+}
@@ -0,0 +1,107 @@
+// Package annex keeps the content of large files out of the object database.
+// Such files are recorded in trees as a small pointer blob, holding the size
+// and SHA-256 of the content, while the content itself lives in a
+// content-addressed Store.
+package annex
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Magic is the header every pointer blob starts with.
+const Magic = "gimini-annex 1\n"
+
+// ErrInvalidPointer is returned when decoding a blob which is not a valid
+// pointer.
+var ErrInvalidPointer = errors.New("invalid annex pointer")
+
+// Pointer references the content of an annexed file.
+type Pointer struct {
+	Size int64
+	// Key is the hex encoded SHA-256 of the content.
+	Key string
+}
+
+// IsPointer returns whether the content starting with head is a pointer.
+func IsPointer(head []byte) bool {
+	return bytes.HasPrefix(head, []byte(Magic))
+}
+
+// IsAnnexed returns whether a file of the given size is annexed, given the
+// threshold of its path. A zero threshold disables annexing.
+func IsAnnexed(size, threshold int64) bool {
+	return threshold > 0 && size >= threshold
+}
+
+// NewPointer reads r until io.EOF and returns the pointer to its content.
+func NewPointer(r io.Reader) (*Pointer, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pointer{Size: n, Key: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Encode writes the pointer to w.
+func (p *Pointer) Encode(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%ssize %d\nsha256 %s\n", Magic, p.Size, p.Key)
+	return err
+}
+
+// Decode reads a pointer from r.
+func (p *Pointer) Decode(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+
+	if !sc.Scan() || sc.Text()+"\n" != Magic {
+		return ErrInvalidPointer
+	}
+
+	if !sc.Scan() {
+		return ErrInvalidPointer
+	}
+
+	if _, err := fmt.Sscanf(sc.Text(), "size %d", &p.Size); err != nil {
+		return ErrInvalidPointer
+	}
+
+	if !sc.Scan() {
+		return ErrInvalidPointer
+	}
+
+	if _, err := fmt.Sscanf(sc.Text(), "sha256 %s", &p.Key); err != nil || !isValidKey(p.Key) {
+		return ErrInvalidPointer
+	}
+
+	if sc.Scan() {
+		return ErrInvalidPointer
+	}
+
+	return sc.Err()
+}
+
+// Bytes returns the content of the pointer blob.
+func (p *Pointer) Bytes() []byte {
+	var buf bytes.Buffer
+	p.Encode(&buf)
+	return buf.Bytes()
+}
+
+// Hash returns the hash of the pointer blob.
+func (p *Pointer) Hash() plumbing.Hash {
+	return plumbing.ComputeHash(plumbing.BlobObject, p.Bytes())
+}
+
+func isValidKey(key string) bool {
+	b, err := hex.DecodeString(key)
+	return err == nil && len(b) == sha256.Size
+}
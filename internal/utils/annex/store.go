@@ -0,0 +1,192 @@
+package annex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// ErrCorruptContent is returned when the content put in a Store does not
+// match the expected key.
+var ErrCorruptContent = errors.New("annexed content does not match its key")
+
+// Store is a content-addressed directory of annexed content, each file is
+// named after its key and split in directories by the first two characters
+// of it, like loose objects.
+type Store struct {
+	fs billy.Filesystem
+}
+
+// NewStore returns a Store keeping its content in fs.
+func NewStore(fs billy.Filesystem) *Store {
+	return &Store{fs: fs}
+}
+
+// Root returns the directory the store keeps its content in.
+func (s *Store) Root() string {
+	return s.fs.Root()
+}
+
+func (s *Store) path(key string) string {
+	return path.Join(key[:2], key[2:])
+}
+
+// Has returns whether the store holds the content with the given key.
+func (s *Store) Has(key string) bool {
+	_, err := s.fs.Stat(s.path(key))
+	return err == nil
+}
+
+// Size returns the size of the content with the given key.
+func (s *Store) Size(key string) (int64, error) {
+	fi, err := s.Stat(key)
+	if err != nil {
+		return 0, err
+	}
+
+	return fi.Size(), nil
+}
+
+// Stat returns the file info of the content with the given key.
+func (s *Store) Stat(key string) (os.FileInfo, error) {
+	return s.fs.Stat(s.path(key))
+}
+
+// Open returns a reader of the content with the given key.
+func (s *Store) Open(key string) (io.ReadCloser, error) {
+	return s.fs.Open(s.path(key))
+}
+
+// Put writes the content of r to the store and returns the pointer to it.
+func (s *Store) Put(r io.Reader) (p *Pointer, err error) {
+	tmp, err := s.fs.TempFile("", "tmp-")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			s.fs.Remove(tmp.Name())
+		}
+	}()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	p = &Pointer{Size: n, Key: hex.EncodeToString(h.Sum(nil))}
+	if s.Has(p.Key) {
+		return p, s.fs.Remove(tmp.Name())
+	}
+
+	if err := s.fs.MkdirAll(path.Dir(s.path(p.Key)), 0755); err != nil {
+		return nil, err
+	}
+
+	return p, s.fs.Rename(tmp.Name(), s.path(p.Key))
+}
+
+// Copy copies the content with the given key from src to the store, unless
+// it is already there.
+func (s *Store) Copy(src *Store, key string) (err error) {
+	if s.Has(key) {
+		return nil
+	}
+
+	r, err := src.Open(key)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	p, err := s.Put(r)
+	if err != nil {
+		return err
+	}
+
+	if p.Key != key {
+		s.Remove(p.Key)
+		return ErrCorruptContent
+	}
+
+	return nil
+}
+
+// Verify returns ErrCorruptContent when the content with the given key does
+// not hash to it.
+func (s *Store) Verify(key string) (err error) {
+	r, err := s.Open(key)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	p, err := NewPointer(r)
+	if err != nil {
+		return err
+	}
+
+	if p.Key != key {
+		return ErrCorruptContent
+	}
+
+	return nil
+}
+
+// Remove deletes the content with the given key from the store.
+func (s *Store) Remove(key string) error {
+	err := s.fs.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// ForEach calls fn with the key of every content in the store.
+func (s *Store) ForEach(fn func(key string) error) error {
+	dirs, err := s.fs.ReadDir("")
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+
+		files, err := s.fs.ReadDir(dir.Name())
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if key := dir.Name() + f.Name(); isValidKey(key) {
+				if err := fn(key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+// Package chunker splits file contents into content-defined chunks, so that a
+// local change in a large file only produces new chunks around the change.
+//
+// The cut points are found with a gear rolling hash, in the same fashion as
+// FastCDC: a boundary is placed wherever the hash of the last bytes matches a
+// mask, bounded by a minimum and a maximum chunk size.
+package chunker
+
+import (
+	"io"
+)
+
+const (
+	// MinSize is the smallest chunk produced, except for the last one.
+	MinSize = 256 << 10
+	// AvgSize is the expected average size of the chunks.
+	AvgSize = 1 << 20
+	// MaxSize is the biggest chunk produced.
+	MaxSize = 4 << 20
+
+	// mask has log2(AvgSize) of the highest bits set, the ones influenced by
+	// the last 64 bytes, a boundary is found on average every AvgSize bytes
+	// after MinSize.
+	mask = uint64(AvgSize-1) << 44
+)
+
+// gear is the table of random values used by the rolling hash. It is
+// generated from a fixed seed, the values must never change or previously
+// stored files would be split differently.
+var gear [256]uint64
+
+func init() {
+	seed := uint64(0x6a09e667f3bcc908)
+	for i := range gear {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunker reads from a io.Reader returning its content split in
+// content-defined chunks.
+type Chunker struct {
+	r   io.Reader
+	buf []byte
+
+	start, end int
+	eof        bool
+}
+
+// New returns a Chunker reading from r.
+func New(r io.Reader) *Chunker {
+	return &Chunker{r: r, buf: make([]byte, MaxSize)}
+}
+
+// Next returns the next chunk, the returned slice is only valid until the
+// next call to Next. At the end of the input io.EOF is returned.
+func (c *Chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+
+	n := cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+
+	return chunk, nil
+}
+
+// fill makes sure the buffer holds at least MaxSize bytes, unless the end of
+// the input was reached.
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start == len(c.buf) {
+		return nil
+	}
+
+	c.end = copy(c.buf, c.buf[c.start:c.end])
+	c.start = 0
+
+	for c.end < len(c.buf) {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+
+		if err == io.EOF {
+			c.eof = true
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cut returns the length of the chunk at the beginning of data.
+func cut(data []byte) int {
+	if len(data) <= MinSize {
+		return len(data)
+	}
+
+	if len(data) > MaxSize {
+		data = data[:MaxSize]
+	}
+
+	var h uint64
+	for i := MinSize; i < len(data); i++ {
+		h = (h << 1) + gear[data[i]]
+		if h&mask == 0 {
+			return i + 1
+		}
+	}
+
+	return len(data)
+}
+
+// Split reads r until io.EOF calling fn with every chunk.
+func Split(r io.Reader, fn func(chunk []byte) error) error {
+	c := New(r)
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := fn(chunk); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package chunker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ChunkerSuite struct{}
+
+var _ = Suite(&ChunkerSuite{})
+
+func randomData(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func chunks(c *C, data []byte) [][]byte {
+	var result [][]byte
+	err := Split(bytes.NewReader(data), func(chunk []byte) error {
+		result = append(result, append([]byte(nil), chunk...))
+		return nil
+	})
+
+	c.Assert(err, IsNil)
+	return result
+}
+
+func (s *ChunkerSuite) TestSplitBounds(c *C) {
+	data := randomData(1, 20<<20)
+	result := chunks(c, data)
+
+	c.Assert(len(result) > 1, Equals, true)
+	c.Assert(bytes.Join(result, nil), DeepEquals, data)
+
+	for i, chunk := range result {
+		c.Assert(len(chunk) <= MaxSize, Equals, true)
+		if i != len(result)-1 {
+			c.Assert(len(chunk) >= MinSize, Equals, true)
+		}
+	}
+}
+
+func (s *ChunkerSuite) TestSplitSmall(c *C) {
+	c.Assert(chunks(c, []byte("foo")), DeepEquals, [][]byte{[]byte("foo")})
+	c.Assert(chunks(c, nil), HasLen, 0)
+}
+
+func (s *ChunkerSuite) TestSplitInsertion(c *C) {
+	data := randomData(2, 16<<20)
+
+	modified := append([]byte(nil), data[:8<<20]...)
+	modified = append(modified, []byte("inserted in the middle")...)
+	modified = append(modified, data[8<<20:]...)
+
+	known := map[plumbing.Hash]bool{}
+	for _, chunk := range chunks(c, data) {
+		known[plumbing.ComputeHash(plumbing.BlobObject, chunk)] = true
+	}
+
+	var changed int
+	for _, chunk := range chunks(c, modified) {
+		if !known[plumbing.ComputeHash(plumbing.BlobObject, chunk)] {
+			changed++
+		}
+	}
+
+	c.Assert(changed > 0, Equals, true)
+	c.Assert(changed <= 2, Equals, true)
+}
+
+func (s *ChunkerSuite) TestManifestEncodeDecode(c *C) {
+	m := &Manifest{Size: 3, Chunks: []Chunk{
+		{Hash: plumbing.NewHash("19102815663d23f8b75a47e7a01965dcdc96468c"), Size: 1},
+		{Hash: plumbing.NewHash("c6b2a7f3b8a6ee1d2b5f2e4c0e0ea6a2d0fbd5c3"), Size: 2},
+	}}
+
+	var buf bytes.Buffer
+	c.Assert(m.Encode(&buf), IsNil)
+	c.Assert(IsManifest(buf.Bytes()), Equals, true)
+
+	decoded := &Manifest{}
+	c.Assert(decoded.Decode(&buf), IsNil)
+	c.Assert(decoded, DeepEquals, m)
+}
+
+func (s *ChunkerSuite) TestManifestDecodeInvalid(c *C) {
+	m := &Manifest{}
+	c.Assert(m.Decode(bytes.NewBufferString("foo")), Equals, ErrInvalidManifest)
+	c.Assert(m.Decode(bytes.NewBufferString(Magic+"size 3\n")), Equals, ErrInvalidManifest)
+}
+
+func (s *ChunkerSuite) TestStoreAndRead(c *C) {
+	data := randomData(3, 10<<20)
+	st := memory.NewStorage()
+
+	h, err := Store(st, bytes.NewReader(data))
+	c.Assert(err, IsNil)
+
+	expected, err := Hash(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, expected)
+
+	obj, err := st.EncodedObject(plumbing.BlobObject, h)
+	c.Assert(err, IsNil)
+
+	r, err := obj.Reader()
+	c.Assert(err, IsNil)
+
+	m := &Manifest{}
+	c.Assert(m.Decode(r), IsNil)
+	c.Assert(m.Size, Equals, int64(len(data)))
+
+	content, err := ioutil.ReadAll(NewReader(st, m))
+	c.Assert(err, IsNil)
+	c.Assert(content, DeepEquals, data)
+}
@@ -0,0 +1,224 @@
+package chunker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// Magic is the header every manifest blob starts with.
+const Magic = "gimini-chunked 1\n"
+
+// ErrInvalidManifest is returned when decoding a blob which is not a valid
+// manifest.
+var ErrInvalidManifest = errors.New("invalid chunk manifest")
+
+// Chunk is a piece of a chunked file, stored as its own blob.
+type Chunk struct {
+	Hash plumbing.Hash
+	Size int64
+}
+
+// Manifest lists the chunks a file was split in. It is stored as a blob in
+// place of the content of the file.
+type Manifest struct {
+	Size   int64
+	Chunks []Chunk
+}
+
+// IsManifest returns whether the content starting with head is a manifest.
+// Files whose content starts with Magic are always stored chunked, so a
+// regular file is never taken for a manifest.
+func IsManifest(head []byte) bool {
+	return bytes.HasPrefix(head, []byte(Magic))
+}
+
+// IsChunked returns whether a file of the given size, with its content
+// starting with head, is stored as a manifest of chunks. A zero threshold
+// disables chunking of big files.
+func IsChunked(size, threshold int64, head []byte) bool {
+	return threshold > 0 && size >= threshold || IsManifest(head)
+}
+
+// Encode writes the manifest to w.
+func (m *Manifest) Encode(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "%ssize %d\n", Magic, m.Size); err != nil {
+		return err
+	}
+
+	for _, c := range m.Chunks {
+		if _, err := fmt.Fprintf(w, "chunk %s %d\n", c.Hash, c.Size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Decode reads a manifest from r.
+func (m *Manifest) Decode(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+
+	if !sc.Scan() || sc.Text()+"\n" != Magic {
+		return ErrInvalidManifest
+	}
+
+	if !sc.Scan() {
+		return ErrInvalidManifest
+	}
+
+	if _, err := fmt.Sscanf(sc.Text(), "size %d", &m.Size); err != nil {
+		return ErrInvalidManifest
+	}
+
+	m.Chunks = nil
+
+	var total int64
+	for sc.Scan() {
+		var hash string
+		var c Chunk
+		if _, err := fmt.Sscanf(sc.Text(), "chunk %s %d", &hash, &c.Size); err != nil {
+			return ErrInvalidManifest
+		}
+
+		c.Hash = plumbing.NewHash(hash)
+		m.Chunks = append(m.Chunks, c)
+		total += c.Size
+	}
+
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	if total != m.Size {
+		return ErrInvalidManifest
+	}
+
+	return nil
+}
+
+// Store splits the content of r in chunks, writes the missing ones as blobs
+// to s followed by the manifest listing them, and returns the hash of the
+// manifest blob.
+func Store(s storer.EncodedObjectStorer, r io.Reader) (plumbing.Hash, error) {
+	return build(r, func(data []byte) (plumbing.Hash, error) {
+		h := plumbing.ComputeHash(plumbing.BlobObject, data)
+		if s.HasEncodedObject(h) == nil {
+			return h, nil
+		}
+
+		obj := s.NewEncodedObject()
+		obj.SetType(plumbing.BlobObject)
+		obj.SetSize(int64(len(data)))
+
+		w, err := obj.Writer()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if _, err := w.Write(data); err != nil {
+			w.Close()
+			return plumbing.ZeroHash, err
+		}
+
+		if err := w.Close(); err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return s.SetEncodedObject(obj)
+	})
+}
+
+// Hash returns the hash Store would return for the content of r, without
+// writing anything.
+func Hash(r io.Reader) (plumbing.Hash, error) {
+	return build(r, func(data []byte) (plumbing.Hash, error) {
+		return plumbing.ComputeHash(plumbing.BlobObject, data), nil
+	})
+}
+
+func build(r io.Reader, put func(data []byte) (plumbing.Hash, error)) (plumbing.Hash, error) {
+	m := &Manifest{}
+	err := Split(r, func(chunk []byte) error {
+		h, err := put(chunk)
+		if err != nil {
+			return err
+		}
+
+		m.Chunks = append(m.Chunks, Chunk{Hash: h, Size: int64(len(chunk))})
+		m.Size += int64(len(chunk))
+		return nil
+	})
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var buf bytes.Buffer
+	if err := m.Encode(&buf); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return put(buf.Bytes())
+}
+
+// NewReader returns a reader of the content described by the manifest,
+// reading the chunks one after the other from s.
+func NewReader(s storer.EncodedObjectStorer, m *Manifest) io.ReadCloser {
+	return &reader{s: s, chunks: m.Chunks}
+}
+
+type reader struct {
+	s      storer.EncodedObjectStorer
+	chunks []Chunk
+
+	current io.ReadCloser
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+
+			obj, err := r.s.EncodedObject(plumbing.BlobObject, r.chunks[0].Hash)
+			if err != nil {
+				return 0, err
+			}
+
+			r.current, err = obj.Reader()
+			if err != nil {
+				return 0, err
+			}
+
+			r.chunks = r.chunks[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			err = r.current.Close()
+			r.current = nil
+			if n > 0 || err != nil {
+				return n, err
+			}
+
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (r *reader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+
+	return r.current.Close()
+}
@@ -1,9 +1,15 @@
 package filesystem
 
 import (
+	"bufio"
 	"io"
 	"os"
 	"path"
+	"strings"
+	"syscall"
+
+	"github.com/WhoMeNope/gimini/internal/utils/annex"
+	"github.com/WhoMeNope/gimini/internal/utils/chunker"
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
@@ -24,11 +30,16 @@ var ignore = map[string]bool{
 type node struct {
 	fs         billy.Filesystem
 	submodules map[string]plumbing.Hash
+	options    *Options
+	tracked    *tracked
 
 	path     string
 	hash     []byte
 	children []noder.Noder
 	isDir    bool
+	parent   *node
+	inode    inode
+	hasInode bool
 }
 
 // NewRootNode returns the root node based on a given billy.Filesystem.
@@ -40,7 +51,87 @@ func NewRootNode(
 	fs billy.Filesystem,
 	submodules map[string]plumbing.Hash,
 ) noder.Noder {
-	return &node{fs: fs, submodules: submodules, isDir: true}
+	return NewRootNodeWithOptions(fs, submodules, Options{})
+}
+
+// Options tells the node how the files are stored in the repository, so the
+// computed hashes match the ones of the stored objects.
+type Options struct {
+	// ChunkThreshold is the size from which files are stored as a manifest
+	// of content-defined chunks, zero disables chunking.
+	ChunkThreshold int64
+	// AnnexThreshold is the size from which files are stored as an annex
+	// pointer, zero disables annexing.
+	AnnexThreshold int64
+	// OneFileSystem stops the walk at the directories another filesystem is
+	// mounted on, but the ones in Mounts, relative to the root of the
+	// billy.Filesystem.
+	OneFileSystem bool
+	Mounts        map[string]bool
+	// Follow returns whether the symlink at the given path, relative to the
+	// root of the billy.Filesystem, is walked as the file it points to.
+	Follow func(path string) bool
+	// MaxFileSize is the size above which files are left out, zero
+	// disables the limit.
+	MaxFileSize int64
+}
+
+func (o *Options) isTooLarge(fi os.FileInfo) bool {
+	return o.MaxFileSize > 0 && fi.Mode().IsRegular() && fi.Size() > o.MaxFileSize
+}
+
+// NewRootNodeWithOptions returns the root node based on a given
+// billy.Filesystem and the Options used to store its files.
+func NewRootNodeWithOptions(
+	fs billy.Filesystem,
+	submodules map[string]plumbing.Hash,
+	options Options,
+) noder.Noder {
+	return &node{fs: fs, submodules: submodules, options: &options, isDir: true}
+}
+
+// tracked holds the paths walked by a node created with NewTrackedRootNode.
+type tracked struct {
+	roots     map[string]*Options
+	ancestors map[string]bool
+	onError   func(path string, err error)
+}
+
+// NewTrackedRootNode returns the root node based on a given billy.Filesystem,
+// only walking the given tracked paths, relative to the root of fs, and the
+// directories leading to them. Every tracked path is hashed with its own
+// Options, inherited by the files below it.
+//
+// Files and directories which cannot be read are left out of the tree and
+// passed to onError, when given, instead of failing the walk.
+func NewTrackedRootNode(
+	fs billy.Filesystem,
+	paths map[string]Options,
+	onError func(path string, err error),
+) noder.Noder {
+	t := &tracked{
+		roots:     make(map[string]*Options),
+		ancestors: make(map[string]bool),
+		onError:   onError,
+	}
+
+	for p, options := range paths {
+		options := options
+		p = strings.Trim(path.Clean("/"+p), "/")
+		t.roots[p] = &options
+
+		for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			t.ancestors[dir] = true
+		}
+	}
+
+	root := &node{fs: fs, options: t.roots[""], tracked: t, isDir: true}
+	if fi, err := fs.Lstat(""); err == nil {
+		// the device the children of a tracked root are compared against
+		root.inode, root.hasInode = inodeOf(fi)
+	}
+
+	return root
 }
 
 // Hash the hash of a filesystem is the result of concatenating the computed
@@ -92,7 +183,7 @@ func (n *node) calculateChildren() error {
 			return nil
 		}
 
-		return nil
+		return n.handleError(n.path, err)
 	}
 
 	for _, file := range files {
@@ -100,9 +191,41 @@ func (n *node) calculateChildren() error {
 			continue
 		}
 
-		c, err := n.newChildNode(file)
+		options := n.childOptions(file)
+		if options == nil && !n.isTrackedAncestor(file) {
+			continue
+		}
+
+		if file.Mode()&os.ModeSymlink != 0 {
+			file = n.follow(file, options)
+		}
+
+		if isSpecial(file.Mode()) {
+			// no content to hash, recorded by their metadata if at all,
+			// also when reached through a followed symlink
+			continue
+		}
+
+		if n.isOtherFileSystem(file, options) {
+			continue
+		}
+
+		if options != nil && options.isTooLarge(file) {
+			continue
+		}
+
+		c, err := n.newChildNode(file, options)
+		if os.IsNotExist(err) {
+			// removed since the directory was read
+			continue
+		}
+
 		if err != nil {
-			return err
+			if err := n.handleError(path.Join(n.path, file.Name()), err); err != nil {
+				return err
+			}
+
+			continue
 		}
 
 		n.children = append(n.children, c)
@@ -111,23 +234,115 @@ func (n *node) calculateChildren() error {
 	return nil
 }
 
-func (n *node) newChildNode(file os.FileInfo) (*node, error) {
-	path := path.Join(n.path, file.Name())
+// handleError passes the error reading the file at path to the error handler
+// of the tracked paths, or returns it when there is none.
+func (n *node) handleError(path string, err error) error {
+	if n.tracked == nil || n.tracked.onError == nil {
+		return err
+	}
 
-	hash, err := n.calculateHash(path, file)
+	n.tracked.onError(path, err)
+	return nil
+}
+
+// childOptions returns the Options of the given child, nil if it is not
+// tracked.
+func (n *node) childOptions(file os.FileInfo) *Options {
+	if n.tracked != nil {
+		if options, ok := n.tracked.roots[path.Join(n.path, file.Name())]; ok {
+			return options
+		}
+	}
+
+	return n.options
+}
+
+// follow returns the info of the file the given child symlink points to, when
+// its Options follow it. Dangling symlinks, and the ones pointing to a
+// directory being walked, are not followed.
+func (n *node) follow(file os.FileInfo, options *Options) os.FileInfo {
+	name := path.Join(n.path, file.Name())
+	if options == nil || options.Follow == nil || !options.Follow(name) {
+		return file
+	}
+
+	target, err := n.fs.Stat(name)
 	if err != nil {
-		return nil, err
+		return file
+	}
+
+	if ino, ok := inodeOf(target); ok && target.IsDir() {
+		for p := n; p != nil; p = p.parent {
+			if p.hasInode && p.inode == ino {
+				return file
+			}
+		}
+	}
+
+	return target
+}
+
+// isOtherFileSystem returns whether the given child is a directory another
+// filesystem is mounted on, the walk must not enter given its Options.
+// Tracked paths are always entered.
+func (n *node) isOtherFileSystem(file os.FileInfo, options *Options) bool {
+	if options == nil || !options.OneFileSystem || !file.IsDir() || !n.hasInode {
+		return false
 	}
 
+	name := path.Join(n.path, file.Name())
+	if options.Mounts[name] || n.tracked != nil && n.tracked.roots[name] != nil {
+		return false
+	}
+
+	ino, ok := inodeOf(file)
+	return ok && ino.dev != n.inode.dev
+}
+
+// inode identifies a file, when fs exposes it.
+type inode struct {
+	dev, ino uint64
+}
+
+func inodeOf(file os.FileInfo) (inode, bool) {
+	st, ok := file.Sys().(*syscall.Stat_t)
+	if !ok {
+		return inode{}, false
+	}
+
+	return inode{uint64(st.Dev), uint64(st.Ino)}, true
+}
+
+// isTrackedAncestor returns whether the given child is a directory leading to
+// a tracked path.
+func (n *node) isTrackedAncestor(file os.FileInfo) bool {
+	return n.tracked != nil && file.IsDir() &&
+		n.tracked.ancestors[path.Join(n.path, file.Name())]
+}
+
+func (n *node) newChildNode(file os.FileInfo, options *Options) (*node, error) {
+	path := path.Join(n.path, file.Name())
+
 	node := &node{
 		fs:         n.fs,
 		submodules: n.submodules,
+		options:    options,
+		tracked:    n.tracked,
 
-		path:  path,
-		hash:  hash,
-		isDir: file.IsDir(),
+		path:   path,
+		isDir:  file.IsDir(),
+		parent: n,
 	}
 
+	node.inode, node.hasInode = inodeOf(file)
+
+	hash, err := node.calculateHash(path, file)
+	if err != nil {
+		return nil, err
+	}
+
+	node.hash = hash
+
 	if hash, isSubmodule := n.submodules[path]; isSubmodule {
 		node.hash = append(hash[:], filemode.Submodule.Bytes()...)
 		node.isDir = false
@@ -169,8 +384,25 @@ func (n *node) doCalculateHashForRegular(path string, file os.FileInfo) (plumbin
 
 	defer f.Close()
 
+	if annex.IsAnnexed(file.Size(), n.options.AnnexThreshold) {
+		p, err := annex.NewPointer(f)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return p.Hash(), nil
+	}
+
+	// files looking like a pointer are chunked, so they are never taken
+	// for one
+	r := bufio.NewReader(f)
+	head, _ := r.Peek(len(chunker.Magic))
+	if chunker.IsChunked(file.Size(), n.options.ChunkThreshold, head) || annex.IsPointer(head) {
+		return chunker.Hash(r)
+	}
+
 	h := plumbing.NewHasher(plumbing.BlobObject, file.Size())
-	if _, err := io.Copy(h, f); err != nil {
+	if _, err := io.Copy(h, r); err != nil {
 		return plumbing.ZeroHash, err
 	}
 
@@ -191,6 +423,12 @@ func (n *node) doCalculateHashForSymlink(path string, file os.FileInfo) (plumbin
 	return h.Sum(), nil
 }
 
+// isSpecial returns whether the mode is the one of a socket, FIFO or device
+// node.
+func isSpecial(mode os.FileMode) bool {
+	return mode&(os.ModeSocket|os.ModeNamedPipe|os.ModeDevice|os.ModeCharDevice) != 0
+}
+
 func (n *node) String() string {
 	return n.path
 }
@@ -5,11 +5,14 @@ import (
 	"io"
 	"os"
 	"path"
+	"syscall"
 	"testing"
 
+	"github.com/WhoMeNope/gimini/internal/utils/chunker"
 	. "gopkg.in/check.v1"
 	"gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/osfs"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/utils/merkletrie"
 	"gopkg.in/src-d/go-git.v4/utils/merkletrie/noder"
@@ -195,6 +198,76 @@ func (s *NoderSuite) TestDiffDirectory(c *C) {
 	c.Assert(a, Equals, merkletrie.Modify)
 }
 
+func (s *NoderSuite) TestTrackedRootNode(c *C) {
+	fs := memfs.New()
+	WriteFile(fs, "foo", []byte("foo"), 0644)
+	WriteFile(fs, "qux/bar/foo", []byte("foo"), 0644)
+	WriteFile(fs, "qux/bar/qux", []byte("foo"), 0644)
+	WriteFile(fs, "qux/baz", []byte("foo"), 0644)
+	WriteFile(fs, "qux/foo", []byte("foo"), 0644)
+
+	ch, err := merkletrie.DiffTree(
+		NewRootNode(memfs.New(), nil),
+		NewTrackedRootNode(fs, map[string]Options{
+			"/qux/bar": {},
+			"qux/foo":  {},
+		}, nil),
+		IsEquals,
+	)
+
+	c.Assert(err, IsNil)
+
+	var names []string
+	for _, change := range ch {
+		names = append(names, change.To.String())
+	}
+
+	c.Assert(names, DeepEquals, []string{"qux/bar/foo", "qux/bar/qux", "qux/foo"})
+}
+
+func (s *NoderSuite) TestTrackedRootOneFileSystem(c *C) {
+	root, err := os.Lstat("/")
+	c.Assert(err, IsNil)
+	proc, err := os.Lstat("/proc")
+	if err != nil || proc.Sys().(*syscall.Stat_t).Dev == root.Sys().(*syscall.Stat_t).Dev {
+		c.Skip("/proc is not another filesystem")
+	}
+
+	children, err := NewTrackedRootNode(osfs.New("/"), map[string]Options{
+		"/": {OneFileSystem: true},
+	}, nil).Children()
+	c.Assert(err, IsNil)
+
+	for _, child := range children {
+		c.Assert(child.Name(), Not(Equals), "proc")
+	}
+}
+
+func (s *NoderSuite) TestChunkedHash(c *C) {
+	data := bytes.Repeat([]byte("foo"), 1024)
+
+	fs := memfs.New()
+	WriteFile(fs, "foo", data, 0644)
+	WriteFile(fs, "bar", []byte(chunker.Magic), 0644)
+
+	root := NewRootNodeWithOptions(fs, nil, Options{ChunkThreshold: 1024})
+	children, err := root.Children()
+	c.Assert(err, IsNil)
+
+	hashes := make(map[string][]byte)
+	for _, child := range children {
+		hashes[child.Name()] = child.Hash()[:20]
+	}
+
+	expected, err := chunker.Hash(bytes.NewReader([]byte(chunker.Magic)))
+	c.Assert(err, IsNil)
+	c.Assert(hashes["bar"], DeepEquals, expected[:])
+
+	expected, err = chunker.Hash(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	c.Assert(hashes["foo"], DeepEquals, expected[:])
+}
+
 func WriteFile(fs billy.Filesystem, filename string, data []byte, perm os.FileMode) error {
 	f, err := fs.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
@@ -220,3 +293,18 @@ func IsEquals(a, b noder.Hasher) bool {
 
 	return bytes.Equal(a.Hash(), b.Hash())
 }
+
+func (s *NoderSuite) TestFollowSymlink(c *C) {
+	fs := memfs.New()
+	WriteFile(fs, "foo", []byte("foo"), 0644)
+	fs.Symlink("foo", "bar")
+
+	root := NewRootNodeWithOptions(fs, nil, Options{
+		Follow: func(path string) bool { return path == "bar" },
+	})
+
+	children, err := root.Children()
+	c.Assert(err, IsNil)
+	c.Assert(children, HasLen, 2)
+	c.Assert(children[0].Hash(), DeepEquals, children[1].Hash())
+}
@@ -0,0 +1,236 @@
+// Package watcher reports the files changed below a set of paths, watching
+// their directories recursively with inotify.
+package watcher
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// events are the inotify events telling a file was changed.
+const events = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ATTRIB | unix.IN_MODIFY |
+	unix.IN_DELETE_SELF | unix.IN_ONLYDIR
+
+// SkipFunc returns whether the directory at path, child of parent, is left
+// unwatched along with everything below it.
+type SkipFunc func(path string, parent, dir os.FileInfo) bool
+
+// Watcher sends the paths of the changed files, at or below the watched
+// paths, to Events. A changed directory stands for everything below it.
+type Watcher struct {
+	Events chan string
+	Errors chan error
+
+	file  *os.File
+	roots []string
+	skip  SkipFunc
+
+	// done is closed by Close, stopping read when nobody receives anymore
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	watches map[int]string
+}
+
+// New watches the paths, which are either directories, watched recursively,
+// or files, watched through their directory.
+func New(paths []string, skip SkipFunc) (*Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	w := &Watcher{
+		Events:  make(chan string),
+		Errors:  make(chan error),
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		roots:   paths,
+		skip:    skip,
+		done:    make(chan struct{}),
+		watches: make(map[int]string),
+	}
+
+	for _, p := range paths {
+		if err := w.addRoot(p); err != nil {
+			w.file.Close()
+			return nil, err
+		}
+	}
+
+	go w.read()
+	return w, nil
+}
+
+// Close stops watching, closing Events. The events not received yet are
+// dropped.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() { close(w.done) })
+	return w.file.Close()
+}
+
+func (w *Watcher) addRoot(path string) error {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return w.addRoot(filepath.Dir(path))
+	}
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return w.add(filepath.Dir(path))
+	}
+
+	return w.addRecursive(path, fi)
+}
+
+// addRecursive watches the directory and the directories below it, but for
+// the skipped ones.
+func (w *Watcher) addRecursive(path string, dir os.FileInfo) error {
+	if err := w.add(path); err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		name := filepath.Join(path, file.Name())
+		if !file.IsDir() || w.skip != nil && w.skip(name, dir, file) {
+			continue
+		}
+
+		if err := w.addRecursive(name, file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *Watcher) add(path string) error {
+	wd, err := unix.InotifyAddWatch(int(w.file.Fd()), path, events)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+	}
+
+	w.mu.Lock()
+	w.watches[wd] = path
+	w.mu.Unlock()
+	return nil
+}
+
+// read sends the events until the watcher is closed.
+func (w *Watcher) read() {
+	defer close(w.Events)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if pe, ok := err.(*os.PathError); !ok || pe.Err != os.ErrClosed {
+				w.fail(err)
+			}
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			e := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			name := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(e.Len)]
+			offset += unix.SizeofInotifyEvent + int(e.Len)
+
+			if !w.handle(e, string(bytes.TrimRight(name, "\x00"))) {
+				return
+			}
+		}
+	}
+}
+
+// send sends the path to Events, false when the watcher was closed instead.
+func (w *Watcher) send(path string) bool {
+	select {
+	case w.Events <- path:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// fail sends the error to Errors, unless the watcher was closed.
+func (w *Watcher) fail(err error) {
+	select {
+	case w.Errors <- err:
+	case <-w.done:
+	}
+}
+
+// handle sends the paths the event tells were changed, false when the
+// watcher was closed meanwhile.
+func (w *Watcher) handle(e *unix.InotifyEvent, name string) bool {
+	if e.Mask&unix.IN_Q_OVERFLOW != 0 {
+		// Events were lost, anything may have changed
+		for _, p := range w.roots {
+			if !w.send(p) {
+				return false
+			}
+		}
+		return true
+	}
+
+	w.mu.Lock()
+	dir, ok := w.watches[int(e.Wd)]
+	if e.Mask&unix.IN_IGNORED != 0 {
+		delete(w.watches, int(e.Wd))
+	}
+	w.mu.Unlock()
+
+	if !ok || e.Mask&unix.IN_IGNORED != 0 {
+		return true
+	}
+
+	path := dir
+	if name != "" {
+		path = filepath.Join(dir, name)
+	}
+
+	if !w.isWatched(path) {
+		return true
+	}
+
+	// Watch the new directories, the files created before the watch are
+	// covered by the event of the directory itself
+	if e.Mask&unix.IN_ISDIR != 0 && e.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+		parent, perr := os.Stat(dir)
+		fi, err := os.Stat(path)
+		if err == nil && perr == nil && (w.skip == nil || !w.skip(path, parent, fi)) {
+			if err := w.addRecursive(path, fi); err != nil && !os.IsNotExist(err) {
+				w.fail(err)
+			}
+		}
+	}
+
+	return w.send(path)
+}
+
+// isWatched returns whether the path is at or below one of the watched
+// paths, the directories of the files watched holding other files too.
+func (w *Watcher) isWatched(path string) bool {
+	for _, p := range w.roots {
+		if path == p || strings.HasPrefix(path, p+"/") || p == "/" {
+			return true
+		}
+	}
+
+	return false
+}
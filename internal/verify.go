@@ -0,0 +1,321 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"path"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+
+	"github.com/WhoMeNope/gimini/internal/utils/annex"
+)
+
+// VerifyResult tells what verify checked and the problems it found.
+type VerifyResult struct {
+	Commits int
+	Trees   int
+	// Blobs is the number of blobs whose content was hashed, the others
+	// were only checked for presence.
+	Blobs    int
+	Problems []string
+}
+
+// verifier walks the objects reachable from the references and the index,
+// checking each object once. Chunks only checked for presence are kept apart
+// from the seen ones, a sampled blob referencing them hashes them still.
+type verifier struct {
+	r       *Repository
+	percent float64
+	seen    map[plumbing.Hash]bool
+	present map[plumbing.Hash]bool
+	res     *VerifyResult
+}
+
+// Verify checks every commit, tree and blob reachable from the references:
+// that they are present and that their content matches their hash. Only
+// about percent% of the blobs, with the chunks and annexed content they
+// reference, are read and hashed, the others are only checked for presence
+// along with their chunks and annexed content.
+// Index entries whose blob is missing are reported as dangling.
+func (r *Repository) Verify(percent float64) (*VerifyResult, error) {
+	v := &verifier{
+		r:       r,
+		percent: percent,
+		seen:    make(map[plumbing.Hash]bool),
+		present: make(map[plumbing.Hash]bool),
+		res:     &VerifyResult{},
+	}
+
+	refs, err := r.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			v.object(ref.Hash(), ref.Name().String())
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Mode == filemode.Submodule {
+			continue
+		}
+
+		if r.Storer.HasEncodedObject(e.Hash) != nil {
+			v.problem("dangling index entry %s: blob %s is missing", e.Name, e.Hash)
+		}
+	}
+
+	return v.res, nil
+}
+
+func (v *verifier) problem(format string, a ...interface{}) {
+	v.res.Problems = append(v.res.Problems, fmt.Sprintf(format, a...))
+}
+
+// read returns the object after checking its content matches the hash it
+// is referenced by, nil when it is missing or corrupt.
+func (v *verifier) read(h plumbing.Hash, t plumbing.ObjectType, name string) plumbing.EncodedObject {
+	obj, err := v.r.Storer.EncodedObject(t, h)
+	if err != nil {
+		v.problem("%s: %s %s: %s", name, t, h, err)
+		return nil
+	}
+
+	if err := checkHash(obj, h); err != nil {
+		v.problem("%s: %s %s: %s", name, obj.Type(), h, err)
+		return nil
+	}
+
+	return obj
+}
+
+// checkHash reads the object and checks its content matches the hash it is
+// referenced by. The hash of the object itself cannot be trusted, go-git
+// computes it from the content of loose objects.
+func checkHash(obj plumbing.EncodedObject, h plumbing.Hash) (err error) {
+	src, err := obj.Reader()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(src, &err)
+
+	hasher := plumbing.NewHasher(obj.Type(), obj.Size())
+	if _, err := io.Copy(hasher, src); err != nil {
+		return err
+	}
+
+	if sum := hasher.Sum(); sum != h {
+		return fmt.Errorf("corrupt, content hashes to %s", sum)
+	}
+
+	return nil
+}
+
+// object checks the object, whatever its type, and the ones it references.
+func (v *verifier) object(h plumbing.Hash, name string) {
+	if v.seen[h] {
+		return
+	}
+
+	obj, err := v.r.Storer.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		v.problem("%s: object %s: %s", name, h, err)
+		return
+	}
+
+	switch obj.Type() {
+	case plumbing.CommitObject:
+		v.commit(h, name)
+	case plumbing.TreeObject:
+		v.tree(h, name)
+	case plumbing.BlobObject:
+		v.blob(h, name)
+	case plumbing.TagObject:
+		v.seen[h] = true
+		if obj = v.read(h, plumbing.TagObject, name); obj == nil {
+			return
+		}
+
+		tag, err := object.DecodeTag(v.r.Storer, obj)
+		if err != nil {
+			v.problem("%s: tag %s: %s", name, h, err)
+			return
+		}
+
+		v.object(tag.Target, name)
+	}
+}
+
+// commit checks the commit, its tree and its ancestors.
+func (v *verifier) commit(h plumbing.Hash, name string) {
+	pending := []plumbing.Hash{h}
+	for len(pending) != 0 {
+		h, pending = pending[len(pending)-1], pending[:len(pending)-1]
+		if v.seen[h] {
+			continue
+		}
+
+		v.seen[h] = true
+
+		obj := v.read(h, plumbing.CommitObject, name)
+		if obj == nil {
+			continue
+		}
+
+		c, err := object.DecodeCommit(v.r.Storer, obj)
+		if err != nil {
+			v.problem("%s: commit %s: %s", name, h, err)
+			continue
+		}
+
+		v.res.Commits++
+		v.tree(c.TreeHash, "commit "+h.String())
+		pending = append(pending, c.ParentHashes...)
+	}
+}
+
+// tree checks the tree and the trees and blobs it holds, named after their
+// path below the tree of a commit.
+func (v *verifier) tree(h plumbing.Hash, name string) {
+	if v.seen[h] {
+		return
+	}
+
+	v.seen[h] = true
+
+	obj := v.read(h, plumbing.TreeObject, name)
+	if obj == nil {
+		return
+	}
+
+	tree, err := object.DecodeTree(v.r.Storer, obj)
+	if err != nil {
+		v.problem("%s: tree %s: %s", name, h, err)
+		return
+	}
+
+	v.res.Trees++
+	for _, e := range tree.Entries {
+		switch e.Mode {
+		case filemode.Dir:
+			v.tree(e.Hash, path.Join(name, e.Name))
+		case filemode.Submodule:
+		default:
+			v.blob(e.Hash, path.Join(name, e.Name))
+		}
+	}
+}
+
+// blob checks the blob, along with the chunks or the annexed content it
+// references, is present and, when sampled, their content.
+func (v *verifier) blob(h plumbing.Hash, name string) {
+	if v.seen[h] {
+		return
+	}
+
+	v.seen[h] = true
+
+	sampled := rand.Float64()*100 < v.percent
+	if sampled {
+		if v.read(h, plumbing.BlobObject, name) == nil {
+			return
+		}
+
+		v.res.Blobs++
+	} else if err := v.r.Storer.HasEncodedObject(h); err != nil {
+		v.problem("%s: blob %s: %s", name, h, err)
+		return
+	}
+
+	if err := v.content(h, name, sampled); err != nil {
+		v.problem("%s: blob %s: %s", name, h, err)
+	}
+}
+
+// content checks the chunks of the blob when it is a manifest, or the
+// annexed content when it is a pointer, only for presence unless sampled.
+// Each chunk is checked once, whatever the result.
+func (v *verifier) content(h plumbing.Hash, name string, sampled bool) error {
+	m, p, err := v.r.decodeBlob(h)
+	switch {
+	case err != nil:
+		return err
+	case p != nil:
+		return v.annexed(p, sampled)
+	case m != nil:
+		for _, c := range m.Chunks {
+			if v.seen[c.Hash] || !sampled && v.present[c.Hash] {
+				continue
+			}
+
+			if sampled {
+				v.seen[c.Hash] = true
+				v.read(c.Hash, plumbing.BlobObject, name)
+				continue
+			}
+
+			v.present[c.Hash] = true
+			if err := v.r.Storer.HasEncodedObject(c.Hash); err != nil {
+				// reported, no need to read it again
+				v.seen[c.Hash] = true
+				v.problem("%s: blob %s: %s", name, c.Hash, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// annexed checks the annexed content is in a store and, when in the local
+// one and sampled, that it matches its key.
+func (v *verifier) annexed(p *annex.Pointer, sampled bool) (err error) {
+	if !v.r.annex.Has(p.Key) {
+		if remote := v.r.annexRemote(); remote != nil && remote.Has(p.Key) {
+			return nil
+		}
+
+		return fmt.Errorf("annexed content %s is not present in any store", p.Key)
+	}
+
+	if !sampled {
+		return nil
+	}
+
+	src, err := v.r.annex.Open(p.Key)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(src, &err)
+
+	h := sha256.New()
+	if _, err := io.Copy(h, src); err != nil {
+		return err
+	}
+
+	if key := hex.EncodeToString(h.Sum(nil)); key != p.Key {
+		return fmt.Errorf("annexed content %s is corrupt, it hashes to %s", p.Key, key)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	"github.com/WhoMeNope/gimini/internal/utils/chunker"
+)
+
+type VerifySuite struct {
+	homeFixture
+}
+
+var _ = Suite(&VerifySuite{})
+
+func (s *VerifySuite) TestCheckHash(c *C) {
+	obj := &plumbing.MemoryObject{}
+	obj.SetType(plumbing.BlobObject)
+	obj.Write([]byte("foo"))
+	c.Assert(checkHash(obj, obj.Hash()), IsNil)
+
+	bar := plumbing.ComputeHash(plumbing.BlobObject, []byte("bar"))
+	c.Assert(checkHash(obj, bar), ErrorMatches, "corrupt, content hashes to "+obj.Hash().String())
+}
+
+func (s *VerifySuite) TestVerifyCorruptLooseObject(c *C) {
+	w, dir := newTestWorktree(c)
+
+	file := filepath.Join(dir, "file")
+	c.Assert(ioutil.WriteFile(file, []byte("foo"), 0644), IsNil)
+	snapshot(c, w, dir)
+
+	res, err := w.repo.Verify(100)
+	c.Assert(err, IsNil)
+	c.Assert(res.Problems, HasLen, 0)
+
+	// Replace the content of the loose blob, keeping it a valid object
+	h := plumbing.ComputeHash(plumbing.BlobObject, []byte("foo"))
+	path := w.repo.looseObjectPath(h)
+
+	obj := &plumbing.MemoryObject{}
+	obj.SetType(plumbing.BlobObject)
+	obj.Write([]byte("bar"))
+
+	var corrupt bytes.Buffer
+	c.Assert(writeCompressedObject(&corrupt, obj, -1), IsNil)
+	c.Assert(os.Chmod(path, 0644), IsNil)
+	c.Assert(ioutil.WriteFile(path, corrupt.Bytes(), 0644), IsNil)
+
+	res, err = w.repo.Verify(100)
+	c.Assert(err, IsNil)
+	c.Assert(res.Problems, HasLen, 1)
+	c.Assert(res.Problems[0], Matches, ".*blob "+h.String()+": corrupt, content hashes to "+obj.Hash().String())
+}
+
+func (s *VerifySuite) TestVerifyMissingChunk(c *C) {
+	w, dir := newTestWorktree(c)
+	w.repo.config.ChunkThreshold = 1
+
+	data := bytes.Repeat([]byte("foo"), 1<<20)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "file"), data, 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "copy"), append(data, "bar"...), 0644), IsNil)
+	snapshot(c, w, dir)
+
+	var chunks []plumbing.Hash
+	err := chunker.Split(bytes.NewReader(data), func(chunk []byte) error {
+		chunks = append(chunks, plumbing.ComputeHash(plumbing.BlobObject, chunk))
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(os.Remove(w.repo.looseObjectPath(chunks[0])), IsNil)
+
+	// both files reference the chunk, sampled or not it is reported once
+	for _, percent := range []float64{0, 100} {
+		res, err := w.repo.Verify(percent)
+		c.Assert(err, IsNil)
+		c.Assert(res.Problems, HasLen, 1)
+		c.Assert(res.Problems[0], Matches, ".*blob "+chunks[0].String()+": .*")
+	}
+}
@@ -0,0 +1,202 @@
+package internal
+
+import (
+	"os"
+	filepath "path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/WhoMeNope/gimini/internal/utils/watcher"
+)
+
+// Default quiet period and max interval of watch.
+const (
+	defaultWatchQuiet       = 10 * time.Second
+	defaultWatchMaxInterval = 5 * time.Minute
+)
+
+// WatchPolicy is when watch commits the changes it sees: once nothing has
+// changed for Quiet, or MaxInterval after the first change at the latest,
+// for files which never stop changing.
+type WatchPolicy struct {
+	Quiet       time.Duration `yaml:"quiet,omitempty"`
+	MaxInterval time.Duration `yaml:"max_interval,omitempty"`
+}
+
+// WatchPolicy returns the watch policy of the config, defaults filled in.
+func (r *Repository) WatchPolicy() WatchPolicy {
+	p := r.config.Watch
+	if p.Quiet <= 0 {
+		p.Quiet = defaultWatchQuiet
+	}
+	if p.MaxInterval <= 0 {
+		p.MaxInterval = defaultWatchMaxInterval
+	}
+
+	return p
+}
+
+// Watch watches the tracked paths until stop is closed. The changed files
+// are staged in batches following the policy, each batch being committed
+// by commit, which is also given the report of the batch. Batches are
+// snapshotted one at a time, off the loop reading the events, the changes
+// seen meanwhile make the next batch.
+//
+// The pre-add hooks run once per batch, before it is staged. The files they
+// write below the tracked paths are changes like any other, so hooks writing
+// there on every run make watch snapshot again after each quiet period; they
+// should write outside of the tracked paths, or only when their output
+// changed.
+func (w *Worktree) Watch(policy WatchPolicy, commit func(w *Worktree) error, stop <-chan struct{}) error {
+	wt, err := watcher.New(w.repo.config.trackedPaths(), func(path string, parent, dir os.FileInfo) bool {
+		return filepath.Base(path) == sidecarDir || w.isOtherFileSystem(path, parent, dir)
+	})
+	if err != nil {
+		return err
+	}
+	defer wt.Close()
+
+	changed := make(map[string]bool)
+	var first time.Time
+
+	timer := time.NewTimer(policy.Quiet)
+	timer.Stop()
+
+	// running receives the result of the snapshot in progress, nil when
+	// there is none; due tells the quiet period ended meanwhile
+	var running chan error
+	due := false
+
+	flush := func() {
+		paths := changedRoots(changed)
+		changed = make(map[string]bool)
+		first = time.Time{}
+
+		if len(paths) == 0 {
+			return
+		}
+
+		running = make(chan error, 1)
+		go func() {
+			running <- w.snapshotChanges(paths, commit)
+		}()
+	}
+
+	wait := func() error {
+		if running == nil {
+			return nil
+		}
+
+		err := <-running
+		running = nil
+		return err
+	}
+
+	finish := func() error {
+		if err := wait(); err != nil {
+			return err
+		}
+
+		flush()
+		return wait()
+	}
+
+	for {
+		select {
+		case path, ok := <-wt.Events:
+			if !ok {
+				return finish()
+			}
+
+			_, tracked := w.repo.config.trackedPath(path)
+			if !tracked || strings.Contains(path+"/", "/"+sidecarDir+"/") {
+				continue
+			}
+
+			now := time.Now()
+			if first.IsZero() {
+				first = now
+			}
+			changed[path] = true
+
+			wait := policy.Quiet
+			if deadline := first.Add(policy.MaxInterval); now.Add(wait).After(deadline) {
+				wait = deadline.Sub(now)
+			}
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+
+		case <-timer.C:
+			if running != nil {
+				due = true
+				continue
+			}
+
+			flush()
+
+		case err := <-running:
+			running = nil
+			if err != nil {
+				return err
+			}
+
+			if due {
+				due = false
+				flush()
+			}
+
+		case err := <-wt.Errors:
+			if werr := wait(); werr != nil {
+				return werr
+			}
+
+			return err
+
+		case <-stop:
+			return finish()
+		}
+	}
+}
+
+// snapshotChanges stages the changed paths, after running the pre-add hooks,
+// and commits them with commit.
+func (w *Worktree) snapshotChanges(paths []string, commit func(w *Worktree) error) error {
+	w.report = Report{}
+	if err := w.PreAdd(paths); err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		if _, err := w.Add(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return commit(w)
+}
+
+// changedRoots returns the changed paths which are not below another one,
+// sorted.
+func changedRoots(changed map[string]bool) []string {
+	var paths []string
+	for p := range changed {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var roots []string
+	for _, p := range paths {
+		if len(roots) == 0 || !isBelowAny(p, roots) {
+			roots = append(roots, p)
+		}
+	}
+
+	return roots
+}
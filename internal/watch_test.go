@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+type WatchSuite struct {
+	homeFixture
+}
+
+var _ = Suite(&WatchSuite{})
+
+func (s *WatchSuite) TestChangedRoots(c *C) {
+	c.Assert(changedRoots(map[string]bool{}), HasLen, 0)
+
+	c.Assert(changedRoots(map[string]bool{
+		"/etc/hosts":        true,
+		"/etc/nginx/a.conf": true,
+		"/etc/nginx":        true,
+		"/etc/nginxx":       true,
+	}), DeepEquals, []string{"/etc/hosts", "/etc/nginx", "/etc/nginxx"})
+}
+
+func (s *WatchSuite) TestWatch(c *C) {
+	w, dir := newTestWorktree(c)
+	w.repo.config.Paths = append(w.repo.config.Paths, pathConfig{Path: dir})
+
+	// tells whether each snapshot holds the files of the burst below, the
+	// repository is only read by the snapshots
+	commits := make(chan bool, 100)
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		policy := WatchPolicy{Quiet: 50 * time.Millisecond, MaxInterval: time.Second}
+		done <- w.Watch(policy, func(w *Worktree) error {
+			h, err := w.Commit("watch", &git.CommitOptions{
+				Author: &object.Signature{Name: "gimini", Email: "gimini@acme.com", When: time.Now()},
+			})
+			if err != nil && err != ErrEmptyCommit {
+				return err
+			}
+
+			ok, err := hasFiles(w, h, dir, 200)
+			commits <- ok
+			return err
+		}, stop)
+	}()
+
+	// the watches may not be added yet, write until a snapshot is made
+	file := filepath.Join(dir, "file")
+	for i := 0; ; i++ {
+		c.Assert(ioutil.WriteFile(file, []byte("foo"), 0644), IsNil)
+
+		select {
+		case <-commits:
+		case <-time.After(500 * time.Millisecond):
+			c.Assert(i < 10, Equals, true, Commentf("no snapshot made"))
+			continue
+		}
+		break
+	}
+
+	// a burst of changes, while snapshots are being made
+	for i := 0; i < 200; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("file%d", i))
+		c.Assert(ioutil.WriteFile(name, []byte("bar"), 0644), IsNil)
+	}
+
+	// events keep being read while snapshotting, none is lost
+	for ok := false; !ok; {
+		select {
+		case ok = <-commits:
+		case <-time.After(10 * time.Second):
+			c.Fatal("changes not snapshotted")
+		}
+	}
+
+	close(stop)
+	c.Assert(<-done, IsNil)
+}
+
+// hasFiles returns whether the commit holds the first n files written by
+// TestWatch.
+func hasFiles(w *Worktree, h plumbing.Hash, dir string, n int) (bool, error) {
+	commit, err := w.repo.CommitObject(h)
+	if err != nil {
+		return false, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return false, err
+	}
+
+	for i := 0; i < n; i++ {
+		_, err := tree.File(treePath(filepath.Join(dir, fmt.Sprintf("file%d", i))))
+		if err == object.ErrFileNotFound {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
@@ -1,12 +1,17 @@
 package internal
 
 import (
+	"bufio"
 	"io"
 	"os"
 	filepath "path"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/WhoMeNope/gimini/internal/utils/annex"
+	"github.com/WhoMeNope/gimini/internal/utils/chunker"
+
 	"gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-billy.v4/osfs"
 
@@ -22,6 +27,9 @@ type Worktree struct {
 
 	repo             *Repository
 	systemFilesystem billy.Filesystem
+	report           Report
+	trigger          Trigger
+	allowEmpty       bool
 }
 
 func (w *Worktree) Repo() (*Repository) {
@@ -33,31 +41,45 @@ func GetWorktree(repo *Repository) (Worktree, error) {
 
 	worktree, err := repo.Worktree()
 	if err != nil {
-		return Worktree{nil, repo, fs}, err
+		return Worktree{Worktree: nil, repo: repo, systemFilesystem: fs}, err
 	}
 
-	return Worktree{worktree, repo, fs}, nil
+	return Worktree{Worktree: worktree, repo: repo, systemFilesystem: fs}, nil
+}
+
+// Report returns the report of the paths skipped or failed so far.
+func (w *Worktree) Report() *Report {
+	return &w.report
 }
 
+// Add tracks the path and stages the files at or below it. A path which no
+// longer exists is staged as deleted, when below a tracked path. The pre-add
+// hooks are left to PreAdd, run once for all the paths of a snapshot.
 func (w *Worktree) Add(path string) (plumbing.Hash, error) {
 	// check if path exists
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return plumbing.ZeroHash, err
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		if _, ok := w.repo.config.trackedPath(path); !ok {
+			return plumbing.ZeroHash, err
+		}
+	} else {
+		// save to config
+		if err := w.repo.config.add(path); err != nil {
+			return plumbing.ZeroHash, err
+		}
 	}
 
-  // save to config
-  err := w.repo.config.add(path)
+  // add to worktree
+	s, err := w.worktreeStatus(path)
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
-  // add to worktree
-	s, err := w.Status()
+	idx, err := w.repo.Storer.Index()
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
-	idx, err := w.repo.Storer.Index()
+	m, err := w.repo.stagedMetadata()
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
@@ -65,17 +87,32 @@ func (w *Worktree) Add(path string) (plumbing.Hash, error) {
 	var h plumbing.Hash
 	var added bool
 
-	fi, err := w.systemFilesystem.Lstat(path)
-	if err != nil || !fi.IsDir() {
-		added, h, err = w.doAddFile(idx, s, path)
-	} else {
-		added, err = w.doAddDirectory(idx, s, path)
+	fi, err := w.lstat(path)
+	switch {
+	case os.IsNotExist(err):
+		// staged as deleted below
+		err = nil
+	case err != nil || !fi.IsDir():
+		added, h, err = w.doAddFile(idx, m, s, path)
+	default:
+		added, err = w.doAddDirectory(idx, m, s, path)
+	}
+
+	if err != nil {
+		return h, err
 	}
 
+	deleted, err := w.doAddDeletions(idx, m, s, path)
 	if err != nil {
 		return h, err
 	}
 
+	added = added || deleted
+
+	if err := w.repo.setStagedMetadata(m); err != nil {
+		return h, err
+	}
+
 	if !added {
 		return h, nil
 	}
@@ -83,20 +120,56 @@ func (w *Worktree) Add(path string) (plumbing.Hash, error) {
 	return h, w.repo.Storer.SetIndex(idx)
 }
 
-func (w *Worktree) doAddDirectory(idx *index.Index, s git.Status, directory string) (added bool, err error) {
+func (w *Worktree) doAddDirectory(idx *index.Index, m metadata, s git.Status, directory string) (added bool, err error) {
 	files, err := w.systemFilesystem.ReadDir(directory)
 	if err != nil {
 		return false, err
 	}
 
+	// directories are recorded by their metadata alone, which keeps the
+	// empty ones in the snapshot
+	if err := w.updateMetadata(m, directory); err != nil {
+		return false, err
+	}
+
+	dir, err := w.lstat(directory)
+	if err != nil {
+		return false, err
+	}
+
 	for _, file := range files {
 		name := filepath.Join(directory, file.Name())
+		if file.Name() == sidecarDir {
+			// never walked, like by status
+			continue
+		}
+
+		if file.Mode()&os.ModeSymlink != 0 {
+			var cycle bool
+			file, cycle, err = w.resolve(name)
+			if err != nil {
+				return
+			}
+
+			if cycle {
+				w.report.warn("%s: symlink loop, stored as a symlink", name)
+			}
+		}
+
+		if file.IsDir() && w.isOtherFileSystem(name, dir, file) {
+			continue
+		}
 
 		var a bool
 		if file.IsDir() {
-			a, err = w.doAddDirectory(idx, s, name)
+			a, err = w.doAddDirectory(idx, m, s, name)
 		} else {
-			a, _, err = w.doAddFile(idx, s, name)
+			a, _, err = w.doAddFile(idx, m, s, name)
+		}
+
+		if isReadError(name, err) {
+			w.report.fail(name, err)
+			a, err = false, nil
 		}
 
 		if err != nil {
@@ -111,16 +184,116 @@ func (w *Worktree) doAddDirectory(idx *index.Index, s git.Status, directory stri
 	return
 }
 
-func (w *Worktree) doAddFile(idx *index.Index, s git.Status, path string) (added bool, h plumbing.Hash, err error) {
-	if s.File(path).Worktree == git.Unmodified {
+// isOtherFileSystem returns whether the directory at path, child of parent,
+// is a mount point the walk must not enter given the config of its tracked
+// path.
+func (w *Worktree) isOtherFileSystem(path string, parent, dir os.FileInfo) bool {
+	p, ok := w.repo.config.trackedPath(path)
+	if !ok || p.Path == path || p.isMountAllowed(path) {
+		return false
+	}
+
+	return deviceOf(dir) != deviceOf(parent)
+}
+
+// isTooLarge returns whether the file at path is above the max file size of
+// its tracked path.
+func (w *Worktree) isTooLarge(path string, fi os.FileInfo) bool {
+	p, _ := w.repo.config.trackedPath(path)
+	max := w.repo.config.maxFileSize(p)
+
+	return max > 0 && fi.Mode().IsRegular() && fi.Size() > max
+}
+
+// doExcludeFile leaves the file at path out of the snapshot for the reason,
+// along with the version of it staged before if any.
+func (w *Worktree) doExcludeFile(idx *index.Index, m metadata, path, reason string) (added bool, err error) {
+	w.report.exclude(path, reason)
+	delete(m, treePath(path))
+
+	if _, err := idx.Entry(w.indexName(path)); err != nil {
+		return false, nil
+	}
+
+	_, err = w.deleteFromIndex(idx, path)
+	return err == nil, err
+}
+
+// deviceOf returns the device the file is on.
+func deviceOf(fi os.FileInfo) uint64 {
+	ino, _ := inodeOf(fi)
+	return ino.dev
+}
+
+// doAddDeletions removes from the index the files at or below path which are
+// gone from the system, and forgets the metadata of the gone directories.
+func (w *Worktree) doAddDeletions(idx *index.Index, m metadata, s git.Status, path string) (added bool, err error) {
+	paths := []string{path}
+
+	for name, fs := range s {
+		if fs.Worktree != git.Deleted || !isBelowAny(name, paths) {
+			continue
+		}
+
+		if fm, ok := m[treePath(name)]; ok && fm.isMetadataOnly() {
+			// not in the index, forgotten below
+			continue
+		}
+
+		a, _, err := w.doAddFile(idx, m, s, name)
+		if isReadError(name, err) {
+			w.report.fail(name, err)
+			continue
+		}
+
+		if err != nil {
+			return added, err
+		}
+
+		added = added || a
+	}
+
+	for name := range m {
+		if isBelowAny(systemPath(name), paths) {
+			if err := w.updateMetadata(m, systemPath(name)); err != nil {
+				return added, err
+			}
+		}
+	}
+
+	return added, nil
+}
+
+func (w *Worktree) doAddFile(idx *index.Index, m metadata, s git.Status, path string) (added bool, h plumbing.Hash, err error) {
+	// lstat resolves the followed symlinks, so the ones pointing to a
+	// special file get its policy too
+	if fi, err := w.lstat(path); err == nil && isSpecial(fi.Mode()) {
+		added, err = w.doAddSpecialFile(idx, m, path)
+		return added, h, err
+	} else if err == nil && w.isTooLarge(path, fi) {
+		added, err = w.doExcludeFile(idx, m, path, "too large")
+		return added, h, err
+	}
+
+	if err := w.updateMetadata(m, path); err != nil {
+		return false, h, err
+	}
+
+	// files missing from the status are unmodified, storing them again
+	// would write loose copies of packed objects
+	if fs, ok := s[path]; !ok || fs.Worktree == git.Unmodified {
 		return false, h, nil
 	}
 
 	h, err = w.copyFileToStorage(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			added = true
 			h, err = w.deleteFromIndex(idx, path)
+			added = err == nil
+			if err == index.ErrEntryNotFound {
+				// untracked file removed since the walk, nothing to stage
+				err = nil
+			}
 		}
 
 		return
@@ -133,12 +306,49 @@ func (w *Worktree) doAddFile(idx *index.Index, s git.Status, path string) (added
 	return true, h, err
 }
 
+// updateMetadata records the current metadata of the file at path, even when
+// its content is unmodified, and forgets it once the file is gone.
+func (w *Worktree) updateMetadata(m metadata, path string) error {
+	fi, err := w.lstat(path)
+	if os.IsNotExist(err) {
+		delete(m, treePath(path))
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fm, err := newFileMetadata(path, fi)
+	if err != nil {
+		return err
+	}
+
+	m[treePath(path)] = fm
+	return nil
+}
+
 func (w *Worktree) copyFileToStorage(path string) (hash plumbing.Hash, err error) {
-	fi, err := w.systemFilesystem.Lstat(path)
+	fi, err := w.lstat(path)
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
+	if fi.Mode()&os.ModeSymlink == 0 {
+		if w.isAnnexed(path, fi) {
+			return w.copyFileToAnnex(path)
+		}
+
+		chunked, err := w.isChunked(path, fi)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if chunked {
+			return w.copyChunkedFileToStorage(path)
+		}
+	}
+
 	obj := w.repo.Storer.NewEncodedObject()
 	obj.SetType(plumbing.BlobObject)
 	obj.SetSize(fi.Size())
@@ -160,7 +370,7 @@ func (w *Worktree) copyFileToStorage(path string) (hash plumbing.Hash, err error
 		return plumbing.ZeroHash, err
 	}
 
-	return w.repo.Storer.SetEncodedObject(obj)
+	return w.repo.setBlob(obj, path)
 }
 
 func (w *Worktree) fillEncodedObjectFromFile(dst io.Writer, path string, fi os.FileInfo) (err error) {
@@ -178,6 +388,67 @@ func (w *Worktree) fillEncodedObjectFromFile(dst io.Writer, path string, fi os.F
 	return err
 }
 
+// isChunked returns whether the file is big enough to be stored as chunks, or
+// has to be because its content looks like a manifest or an annex pointer.
+func (w *Worktree) isChunked(path string, fi os.FileInfo) (chunked bool, err error) {
+	threshold := w.repo.config.chunkThreshold()
+	if threshold > 0 && fi.Size() >= threshold {
+		return true, nil
+	}
+
+	src, err := w.systemFilesystem.Open(path)
+	if err != nil {
+		return false, err
+	}
+
+	defer ioutil.CheckClose(src, &err)
+
+	head, _ := bufio.NewReader(src).Peek(len(chunker.Magic))
+	return chunker.IsChunked(fi.Size(), threshold, head) || annex.IsPointer(head), nil
+}
+
+// isAnnexed returns whether the file is big enough to be annexed according to
+// the tracked path it belongs to.
+func (w *Worktree) isAnnexed(path string, fi os.FileInfo) bool {
+	p, _ := w.repo.config.trackedPath(path)
+	return annex.IsAnnexed(fi.Size(), int64(p.AnnexThreshold))
+}
+
+// copyFileToAnnex puts the content of the file in the annex stores and writes
+// the pointer to it as a blob.
+func (w *Worktree) copyFileToAnnex(path string) (hash plumbing.Hash, err error) {
+	src, err := w.systemFilesystem.Open(path)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	defer ioutil.CheckClose(src, &err)
+
+	p, err := w.repo.annex.Put(src)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if remote := w.repo.annexRemote(); remote != nil {
+		if err := remote.Copy(w.repo.annex, p.Key); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	return w.repo.storeBlob(p.Bytes())
+}
+
+func (w *Worktree) copyChunkedFileToStorage(path string) (hash plumbing.Hash, err error) {
+	src, err := w.systemFilesystem.Open(path)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	defer ioutil.CheckClose(src, &err)
+
+	return chunker.Store(blobStorer{w.repo.Storer, w.repo, path}, src)
+}
+
 func (w *Worktree) fillEncodedObjectFromSymlink(dst io.Writer, path string, fi os.FileInfo) error {
 	target, err := w.systemFilesystem.Readlink(path)
 	if err != nil {
@@ -188,9 +459,20 @@ func (w *Worktree) fillEncodedObjectFromSymlink(dst io.Writer, path string, fi o
 	return err
 }
 
+// indexName returns the name of the index entry of the file at the given
+// system path.
+func (w *Worktree) indexName(path string) string {
+	return filepath.Join(w.Filesystem.Root(), path)
+}
+
+// treeName returns the path, relative to the system root, the file of the
+// index entry with the given name is stored at in trees.
+func (w *Worktree) treeName(name string) string {
+	return strings.TrimPrefix(name, w.Filesystem.Root()+"/")
+}
+
 func (w *Worktree) addOrUpdateFileToIndex(idx *index.Index, filename string, h plumbing.Hash) error {
-	repoRoot := w.Filesystem.Root()
-	repoFilename := filepath.Join(repoRoot, filename)
+	repoFilename := w.indexName(filename)
 
 	e, err := idx.Entry(repoFilename)
 	if err != nil && err != index.ErrEntryNotFound {
@@ -204,7 +486,7 @@ func (w *Worktree) addOrUpdateFileToIndex(idx *index.Index, filename string, h p
 }
 
 func (w *Worktree) doUpdateFileToIndex(e *index.Entry, filename string, h plumbing.Hash) error {
-	info, err := w.systemFilesystem.Lstat(filename)
+	info, err := w.lstat(filename)
 	if err != nil {
 		return err
 	}
@@ -225,10 +507,7 @@ func (w *Worktree) doUpdateFileToIndex(e *index.Entry, filename string, h plumbi
 }
 
 func (w *Worktree) deleteFromIndex(idx *index.Index, path string) (plumbing.Hash, error) {
-	repoRoot := w.Filesystem.Root()
-	repoPath := filepath.Join(repoRoot, path)
-
-	e, err := idx.Remove(repoPath)
+	e, err := idx.Remove(w.indexName(path))
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
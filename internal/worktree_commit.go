@@ -2,10 +2,10 @@ package internal
 
 import (
 	"bytes"
+	"errors"
 	"path"
 	"sort"
 	"strings"
-  "fmt"
 
 	"golang.org/x/crypto/openpgp"
 	"gopkg.in/src-d/go-git.v4"
@@ -18,36 +18,64 @@ import (
 	"gopkg.in/src-d/go-billy.v4"
 )
 
+// ErrEmptyCommit is returned by Commit when the snapshot has the same tree
+// as its parent, unless empty commits are allowed.
+var ErrEmptyCommit = errors.New("nothing changed since the last snapshot")
+
+// SetAllowEmpty sets whether Commit records snapshots which changed nothing,
+// skipped by default.
+func (w *Worktree) SetAllowEmpty(allow bool) {
+	w.allowEmpty = allow
+}
+
 // Commit stores the current contents of the index in a new commit along with
-// a log message from the user describing the changes.
+// a log message from the user describing the changes, generated from the
+// changes when empty.
 func (w *Worktree) Commit(msg string, opts *git.CommitOptions) (plumbing.Hash, error) {
 	if err := opts.Validate(&w.repo.Repository); err != nil {
 		return plumbing.ZeroHash, err
 	}
 
+	paths := w.repo.config.trackedPaths()
+	if err := w.runHooks(preCommit, paths, plumbing.ZeroHash); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
 	// if opts.All {
 	// 	if err := w.autoAddModifiedAndDeleted(); err != nil {
 	// 		return plumbing.ZeroHash, err
 	// 	}
 	// }
 
-	idx, err := w.repo.Storer.Index()
+	idx, err := w.stagingIndex()
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
-  // Translate repo paths to system paths
-	repoRoot := w.Filesystem.Root()
-	for _, idx_entry := range idx.Entries {
-		idx_entry.Name = strings.TrimPrefix(idx_entry.Name, repoRoot)
+	// Record the metadata next to the files
+	m, err := w.snapshotMetadata(idx)
+	if err != nil {
+		return plumbing.ZeroHash, err
 	}
 
-  fmt.Println(idx)
+	e, err := w.buildMetadataEntry(m)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	idx.Entries = append(idx.Entries, e)
+
+	// Record the output of the commands
+	commands, err := w.buildCommandEntries()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	idx.Entries = append(idx.Entries, commands...)
 
   // Build tree
 	h := &buildTreeHelper{
-		fs: w.systemFilesystem,
-		s:  w.repo.Storer,
+		fs:   w.systemFilesystem,
+		s:    w.repo.Storer,
+		dirs: m.directories(),
 	}
 
 	tree, err := h.BuildTree(idx)
@@ -55,6 +83,23 @@ func (w *Worktree) Commit(msg string, opts *git.CommitOptions) (plumbing.Hash, e
 		return plumbing.ZeroHash, err
 	}
 
+	if !w.allowEmpty {
+		empty, err := w.isSameTree(opts.Parents, tree)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if empty {
+			return opts.Parents[0], ErrEmptyCommit
+		}
+	}
+
+	if msg == "" {
+		if msg, err = w.buildMessage(tree); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
   // Build commit
 	commit, err := w.buildCommitObject(msg, opts, tree)
 	if err != nil {
@@ -62,7 +107,11 @@ func (w *Worktree) Commit(msg string, opts *git.CommitOptions) (plumbing.Hash, e
 	}
 
   // Update HEAD reference
-	return commit, w.updateHEAD(commit)
+	if err := w.updateHEAD(commit); err != nil {
+		return commit, err
+	}
+
+	return commit, w.runHooks(postCommit, paths, commit)
 }
 
 // func (w *Worktree) autoAddModifiedAndDeleted() error {
@@ -84,6 +133,20 @@ func (w *Worktree) Commit(msg string, opts *git.CommitOptions) (plumbing.Hash, e
 // 	return nil
 // }
 
+// isSameTree returns whether the tree is the one of the single parent.
+func (w *Worktree) isSameTree(parents []plumbing.Hash, tree plumbing.Hash) (bool, error) {
+	if len(parents) != 1 {
+		return false, nil
+	}
+
+	c, err := w.repo.CommitObject(parents[0])
+	if err != nil {
+		return false, err
+	}
+
+	return c.TreeHash == tree, nil
+}
+
 func (w *Worktree) updateHEAD(commit plumbing.Hash) error {
 	head, err := w.repo.Storer.Reference(plumbing.HEAD)
 	if err != nil {
@@ -141,10 +204,12 @@ func (w *Worktree) buildCommitSignature(commit *object.Commit, signKey *openpgp.
 
 // buildTreeHelper converts a given index.Index file into multiple git objects
 // reading the blobs from the given filesystem and creating the trees from the
-// index structure. The created objects are pushed to a given Storer.
+// index structure, along with the trees of the given directories even if they
+// are empty. The created objects are pushed to a given Storer.
 type buildTreeHelper struct {
-	fs billy.Filesystem
-	s  storage.Storer
+	fs   billy.Filesystem
+	s    storage.Storer
+	dirs []string
 
 	trees   map[string]*object.Tree
 	entries map[string]*object.TreeEntry
@@ -163,9 +228,27 @@ func (h *buildTreeHelper) BuildTree(idx *index.Index) (plumbing.Hash, error) {
 		}
 	}
 
+	for _, dir := range h.dirs {
+		h.commitDirectory(dir)
+	}
+
 	return h.copyTreeToStorageRecursive(rootNode, h.trees[rootNode])
 }
 
+// commitDirectory makes sure the tree of the directory exists, even if no
+// index entry is below it.
+func (h *buildTreeHelper) commitDirectory(name string) {
+	dir := &index.Entry{}
+
+	var fullpath string
+	for _, part := range strings.Split(name, "/") {
+		parent := fullpath
+		fullpath = path.Join(fullpath, part)
+
+		h.doBuildTree(dir, parent, fullpath)
+	}
+}
+
 func (h *buildTreeHelper) commitIndexEntry(e *index.Entry) error {
 	parts := strings.Split(e.Name, "/")
 
@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"io"
+	stdioutil "io/ioutil"
+	"os"
+	filepath "path"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// Restore writes the files stored in the commit back to the system, along
+// with their recorded ownership, permissions and modification time, and
+// recreates the recorded directories, empty ones included, and special
+// files. When paths are given only the files at or below them are restored.
+// The index is left untouched, so restored files show as modified until they
+// are added.
+func (w *Worktree) Restore(commit plumbing.Hash, paths ...string) error {
+	if err := w.restore(commit, paths); err != nil {
+		return err
+	}
+
+	restored := paths
+	if len(restored) == 0 {
+		restored = w.repo.config.trackedPaths()
+	}
+
+	return w.runHooks(postRestore, restored, commit)
+}
+
+func (w *Worktree) restore(commit plumbing.Hash, paths []string) error {
+	m, err := w.repo.commitMetadata(commit)
+	if err != nil {
+		return err
+	}
+
+	err = w.repo.walkFiles(commit, paths, func(path string, entry object.TreeEntry) error {
+		if err := w.restoreFile(path, entry); err != nil {
+			return err
+		}
+
+		if fm, ok := m[treePath(path)]; ok {
+			return applyMetadata(path, fm)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := w.restoreLinks(m, paths); err != nil {
+		return err
+	}
+
+	if err := w.restoreSpecialFiles(m, paths); err != nil {
+		return err
+	}
+
+	return w.restoreDirectories(m, paths)
+}
+
+// restoreLinks replaces the restored files which were hard links by links to
+// the first file of their group, when it was restored too.
+func (w *Worktree) restoreLinks(m metadata, paths []string) error {
+	for name, fm := range m {
+		path, link := systemPath(name), systemPath(fm.Link)
+		if fm.Link == "" || !isBelowAny(path, paths) || !isBelowAny(link, paths) {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := os.Link(link, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreDirectories creates the directories recorded in the metadata, at or
+// below the paths, and applies their metadata. Children go first, so the
+// modification time of their parents is the last one set.
+func (w *Worktree) restoreDirectories(m metadata, paths []string) error {
+	dirs := m.directories()
+	for i := len(dirs) - 1; i >= 0; i-- {
+		path := systemPath(dirs[i])
+		if !isBelowAny(path, paths) {
+			continue
+		}
+
+		if err := w.systemFilesystem.MkdirAll(path, 0755); err != nil {
+			return err
+		}
+
+		if err := applyMetadata(path, m[dirs[i]]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isBelowAny returns whether path is one of the given paths or below one of
+// them, an empty list matches every path.
+func isBelowAny(path string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		if path == p || p == "/" || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *Worktree) restoreFile(path string, entry object.TreeEntry) error {
+	if err := w.systemFilesystem.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if err := w.systemFilesystem.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if entry.Mode == filemode.Symlink {
+		return w.restoreSymlink(path, entry.Hash)
+	}
+
+	perm, err := entry.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+
+	return w.restoreRegular(path, entry.Hash, perm)
+}
+
+func (w *Worktree) restoreRegular(path string, h plumbing.Hash, perm os.FileMode) (err error) {
+	src, err := w.repo.openBlob(h)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(src, &err)
+
+	dst, err := w.systemFilesystem.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(dst, &err)
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func (w *Worktree) restoreSymlink(path string, h plumbing.Hash) (err error) {
+	src, err := w.repo.openBlob(h)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(src, &err)
+
+	target, err := stdioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	return w.systemFilesystem.Symlink(string(target), path)
+}
@@ -2,7 +2,6 @@ package internal
 
 import (
 	"bytes"
-	"fmt"
 	"strings"
 
 	"gopkg.in/src-d/go-git.v4"
@@ -43,17 +42,20 @@ func (w *Worktree) status(commit plumbing.Hash) (git.Status, error) {
 			return nil, err
 		}
 
-		fmt.Println(nameFromAction(&ch))
-		fs := s.File(nameFromAction(&ch))
+		if isSidecar(nameFromAction(&ch)) {
+			continue
+		}
+
+		fs := s.File(systemPath(nameFromAction(&ch)))
 		fs.Worktree = git.Unmodified
 
 		switch a {
 		case merkletrie.Delete:
-			s.File(ch.From.String()).Staging = git.Deleted
+			fs.Staging = git.Deleted
 		case merkletrie.Insert:
-			s.File(ch.To.String()).Staging = git.Added
+			fs.Staging = git.Added
 		case merkletrie.Modify:
-			s.File(ch.To.String()).Staging = git.Modified
+			fs.Staging = git.Modified
 		}
 	}
 
@@ -68,7 +70,7 @@ func (w *Worktree) status(commit plumbing.Hash) (git.Status, error) {
 			return nil, err
 		}
 
-		fs := s.File(nameFromAction(&ch))
+		fs := s.File(systemPath(nameFromAction(&ch)))
 		if fs.Staging == git.Untracked {
 			fs.Staging = git.Unmodified
 		}
@@ -84,9 +86,85 @@ func (w *Worktree) status(commit plumbing.Hash) (git.Status, error) {
 		}
 	}
 
+	if err := w.diffMetadata(s, commit); err != nil {
+		return nil, err
+	}
+
 	return s, nil
 }
 
+// diffMetadata marks as modified the files whose metadata differs between the
+// commit and the index, or between the index and the system. Directories and
+// special files, known by their metadata alone, are also reported as added or
+// deleted.
+func (w *Worktree) diffMetadata(s git.Status, commit plumbing.Hash) error {
+	committed, err := w.repo.commitMetadata(commit)
+	if err != nil {
+		return err
+	}
+
+	staged, err := w.repo.stagedMetadata()
+	if err != nil {
+		return err
+	}
+
+	for name, c := range committed {
+		if _, ok := staged[name]; !ok && c.isMetadataOnly() {
+			fileStatus(s, systemPath(name)).Staging = git.Deleted
+		}
+	}
+
+	for name, m := range staged {
+		path := systemPath(name)
+
+		c, ok := committed[name]
+		if ok && c.changed(m) {
+			if fs := fileStatus(s, path); fs.Staging == git.Unmodified {
+				fs.Staging = git.Modified
+			}
+		}
+
+		if !ok && m.isMetadataOnly() {
+			fileStatus(s, path).Staging = git.Added
+		}
+
+		fi, err := w.lstat(path)
+		if err != nil {
+			// missing files are reported by the diff of the content
+			if m.isMetadataOnly() {
+				fileStatus(s, path).Worktree = git.Deleted
+			}
+
+			continue
+		}
+
+		current, err := newFileMetadata(path, fi)
+		if err != nil {
+			return err
+		}
+
+		if current.changed(m) {
+			if fs := fileStatus(s, path); fs.Worktree == git.Unmodified {
+				fs.Worktree = git.Modified
+			}
+		}
+	}
+
+	return nil
+}
+
+// fileStatus returns the status of the file at path, unmodified if it was
+// not reported yet.
+func fileStatus(s git.Status, path string) *git.FileStatus {
+	fs, ok := s[path]
+	if !ok {
+		fs = &git.FileStatus{Staging: git.Unmodified, Worktree: git.Unmodified}
+		s[path] = fs
+	}
+
+	return fs
+}
+
 func nameFromAction(ch *merkletrie.Change) string {
 	name := ch.To.String()
 	if name == "" {
@@ -96,54 +174,95 @@ func nameFromAction(ch *merkletrie.Change) string {
 	return name
 }
 
-func (w *Worktree) diffStagingWithWorktree() (merkletrie.Changes, error) {
+// systemPath returns the system path of a file stored at the given path of
+// the trees.
+func systemPath(name string) string {
+	return "/" + name
+}
+
+// treePath returns the path in the trees of the file at the given system
+// path.
+func treePath(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+// stagingIndex returns the index with the entries named after their paths in
+// the trees.
+func (w *Worktree) stagingIndex() (*index.Index, error) {
 	idx, err := w.repo.Storer.Index()
 	if err != nil {
 		return nil, err
 	}
 
-	// Translate repo paths to system paths
-	repoRoot := w.Filesystem.Root()
-	for _, idx_entry := range idx.Entries {
-		idx_entry.Name = strings.TrimPrefix(idx_entry.Name, repoRoot)
+	for _, e := range idx.Entries {
+		e.Name = w.treeName(e.Name)
 	}
 
-	fmt.Println(idx)
-
-	// Compare with system files
-	paths := w.repo.config.Paths
-	pathNodeMap := w.repo.config.getFilesystemNodes(w.systemFilesystem)
+	return idx, nil
+}
 
-	pathIndexMap := make(map[string]*index.Index)
-	for _, prefix := range paths {
-		pathIndexMap[prefix] = &index.Index{}
+// worktreeStatus returns the changes of the system against the index, of the
+// files at or below path only.
+func (w *Worktree) worktreeStatus(path string) (git.Status, error) {
+	idx, err := w.stagingIndex()
+	if err != nil {
+		return nil, err
+	}
 
-		for _, idx_entry := range idx.Entries {
-			if strings.HasPrefix(idx_entry.Name, prefix) {
-				pathIndexMap[prefix].Entries = append(pathIndexMap[prefix].Entries, idx_entry)
-			}
+	below := &index.Index{Version: idx.Version}
+	for _, e := range idx.Entries {
+		if isBelowAny(systemPath(e.Name), []string{path}) {
+			below.Entries = append(below.Entries, e)
 		}
 	}
 
-	var changes merkletrie.Changes
-	for _, prefix := range paths {
-		fmt.Println(prefix)
+	changes, err := merkletrie.DiffTree(
+		mindex.NewRootNode(below),
+		w.repo.config.getFilesystemNodeBelow(w.systemFilesystem, path, func(name string, err error) {
+			w.report.fail(systemPath(name), err)
+		}),
+		diffTreeIsEquals,
+	)
 
-		from := mindex.NewRootNode(pathIndexMap[prefix])
-		to := pathNodeMap[prefix]
-
-		fmt.Println(from.Name)
-		fmt.Println(to.Name)
+	if err != nil {
+		return nil, err
+	}
 
-		c, err := merkletrie.DiffTree(from, to, diffTreeIsEquals)
+	s := make(git.Status)
+	for _, ch := range changes {
+		a, err := ch.Action()
 		if err != nil {
 			return nil, err
 		}
 
-		changes = append(changes, c...)
+		fs := s.File(systemPath(nameFromAction(&ch)))
+		fs.Staging = git.Unmodified
+
+		switch a {
+		case merkletrie.Delete:
+			fs.Worktree = git.Deleted
+		case merkletrie.Insert:
+			fs.Worktree = git.Untracked
+		case merkletrie.Modify:
+			fs.Worktree = git.Modified
+		}
 	}
 
-	return changes, nil
+	return s, nil
+}
+
+func (w *Worktree) diffStagingWithWorktree() (merkletrie.Changes, error) {
+	idx, err := w.stagingIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	from := mindex.NewRootNode(idx)
+	to := w.repo.config.getFilesystemNode(w.systemFilesystem, func(name string, err error) {
+		w.report.fail(systemPath(name), err)
+	})
+
+	return merkletrie.DiffTree(from, to, diffTreeIsEquals)
 }
 
 func (w *Worktree) diffCommitWithStaging(commit plumbing.Hash, reverse bool) (merkletrie.Changes, error) {
@@ -158,8 +277,6 @@ func (w *Worktree) diffCommitWithStaging(commit plumbing.Hash, reverse bool) (me
 		if err != nil {
 			return nil, err
 		}
-
-		fmt.Println(t.Entries)
 	}
 
 	return w.diffTreeWithStaging(t, reverse)
@@ -171,17 +288,11 @@ func (w *Worktree) diffTreeWithStaging(t *object.Tree, reverse bool) (merkletrie
 		from = object.NewTreeRootNode(t)
 	}
 
-	idx, err := w.repo.Storer.Index()
+	idx, err := w.stagingIndex()
 	if err != nil {
 		return nil, err
 	}
 
-	// Translate repo paths to system paths
-	repoRoot := w.Filesystem.Root()
-	for _, idx_entry := range idx.Entries {
-		idx_entry.Name = strings.TrimPrefix(idx_entry.Name, repoRoot)
-	}
-
 	to := mindex.NewRootNode(idx)
 
 	if reverse {
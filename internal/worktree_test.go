@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+type WorktreeSuite struct {
+	homeFixture
+}
+
+var _ = Suite(&WorktreeSuite{})
+
+func (s *WorktreeSuite) TestAddUntrackedFileRemoved(c *C) {
+	w, dir := newTestWorktree(c)
+
+	file := filepath.Join(dir, "file")
+	c.Assert(ioutil.WriteFile(file, []byte("foo"), 0644), IsNil)
+
+	st, err := w.worktreeStatus(dir)
+	c.Assert(err, IsNil)
+	c.Assert(st.File(file).Worktree, Equals, git.Untracked)
+
+	// removed between the walk and the copy to storage
+	c.Assert(os.Remove(file), IsNil)
+
+	idx, err := w.repo.Storer.Index()
+	c.Assert(err, IsNil)
+
+	added, _, err := w.doAddFile(idx, metadata{}, st, file)
+	c.Assert(err, IsNil)
+	c.Assert(added, Equals, false)
+}
+
+func (s *WorktreeSuite) TestAddFollowedSymlinkToSpecialFile(c *C) {
+	w, dir := newTestWorktree(c)
+
+	fifo := filepath.Join(c.MkDir(), "fifo")
+	c.Assert(unix.Mkfifo(fifo, 0644), IsNil)
+	link := filepath.Join(dir, "link")
+	c.Assert(os.Symlink(fifo, link), IsNil)
+
+	w.repo.config.Paths = append(w.repo.config.Paths,
+		pathConfig{Path: dir, Symlinks: symlinkFollow})
+
+	_, err := w.Add(dir)
+	c.Assert(err, IsNil)
+	c.Assert(w.Report().Warnings, DeepEquals, []string{link + ": special file skipped"})
+
+	idx, err := w.repo.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Entries, HasLen, 0)
+}
+
+func (s *WorktreeSuite) TestCommitUnchanged(c *C) {
+	w, dir := newTestWorktree(c)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "file"), []byte("foo"), 0644), IsNil)
+	first := snapshot(c, w, dir)
+
+	// commits the unchanged path, returning the error and the head
+	commit := func() (*object.Commit, error) {
+		_, err := w.Add(dir)
+		c.Assert(err, IsNil)
+
+		_, commitErr := w.Commit("snapshot", &git.CommitOptions{
+			Author: &object.Signature{Name: "gimini", Email: "gimini@acme.com", When: time.Now()},
+		})
+
+		ref, err := w.repo.Head()
+		c.Assert(err, IsNil)
+		head, err := w.repo.CommitObject(ref.Hash())
+		c.Assert(err, IsNil)
+
+		return head, commitErr
+	}
+
+	head, err := commit()
+	c.Assert(err, Equals, ErrEmptyCommit)
+	c.Assert(head.Hash, Equals, first)
+
+	w.SetAllowEmpty(true)
+	head, err = commit()
+	c.Assert(err, IsNil)
+	c.Assert(head.ParentHashes, DeepEquals, []plumbing.Hash{first})
+
+	parent, err := w.repo.CommitObject(first)
+	c.Assert(err, IsNil)
+	c.Assert(head.TreeHash, Equals, parent.TreeHash)
+}
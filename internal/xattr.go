@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs returns the extended attributes of the file at the system path,
+// the ones of the file a symlink points to when follow is set. POSIX ACLs are
+// included, Linux exposes them as the system.posix_acl_access and
+// system.posix_acl_default attributes, as are SELinux labels and file
+// capabilities. Filesystems without support for extended attributes have
+// none.
+func readXattrs(path string, follow bool) (map[string][]byte, error) {
+	names, err := listXattrs(path, follow)
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	xattrs := make(map[string][]byte, len(names))
+	for _, name := range names {
+		value, err := getXattr(path, name, follow)
+		if err == unix.ENODATA {
+			// removed since it was listed
+			continue
+		}
+
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+
+		xattrs[name] = value
+	}
+
+	return xattrs, nil
+}
+
+func listXattrs(path string, follow bool) ([]string, error) {
+	list := unix.Llistxattr
+	if follow {
+		list = unix.Listxattr
+	}
+
+	var buf []byte
+	for {
+		size, err := list(path, nil)
+		if isXattrUnsupported(err) {
+			return nil, nil
+		}
+
+		if err != nil || size == 0 {
+			return nil, err
+		}
+
+		buf = make([]byte, size)
+		n, err := list(path, buf)
+		if err == unix.ERANGE {
+			// grew since its size was asked for
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		buf = buf[:n]
+		break
+	}
+
+	var names []string
+	for _, name := range bytes.Split(buf, []byte{0}) {
+		if len(name) != 0 {
+			names = append(names, string(name))
+		}
+	}
+
+	return names, nil
+}
+
+func getXattr(path, name string, follow bool) ([]byte, error) {
+	get := unix.Lgetxattr
+	if follow {
+		get = unix.Getxattr
+	}
+
+	for {
+		size, err := get(path, name, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		value := make([]byte, size)
+		n, err := get(path, name, value)
+		if err == unix.ERANGE {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return value[:n], nil
+	}
+}
+
+// applyXattrs sets the extended attributes on the file at the system path,
+// the file a symlink points to when follow is set, and removes the others.
+// Attributes the process lacks the privileges for, such as security labels
+// when not running as root, or the filesystem does not support, are skipped.
+func applyXattrs(path string, xattrs map[string][]byte, follow bool) error {
+	set, remove := unix.Lsetxattr, unix.Lremovexattr
+	if follow {
+		set, remove = unix.Setxattr, unix.Removexattr
+	}
+
+	for name, value := range xattrs {
+		err := set(path, name, value, 0)
+		if err == nil || isXattrSkipped(err) {
+			continue
+		}
+
+		return fmt.Errorf("setting %s on %s: %s", name, path, err)
+	}
+
+	names, err := listXattrs(path, follow)
+	if err != nil {
+		return &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+
+	for _, name := range names {
+		if _, ok := xattrs[name]; ok {
+			continue
+		}
+
+		err := remove(path, name)
+		if err == nil || err == unix.ENODATA || isXattrSkipped(err) {
+			continue
+		}
+
+		return fmt.Errorf("removing %s from %s: %s", name, path, err)
+	}
+
+	return nil
+}
+
+// isXattrSkipped returns whether the error setting or removing an attribute
+// is one applyXattrs goes on after.
+func isXattrSkipped(err error) bool {
+	return isXattrUnsupported(err) || err == unix.EPERM || err == unix.EACCES
+}
+
+func isXattrUnsupported(err error) bool {
+	return err == unix.ENOTSUP || err == unix.EOPNOTSUPP
+}
+
+// equalXattrs returns whether both sets of attributes are the same.
+func equalXattrs(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for name, value := range a {
+		other, ok := b[name]
+		if !ok || !bytes.Equal(value, other) {
+			return false
+		}
+	}
+
+	return true
+}
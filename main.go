@@ -1,74 +1,95 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"time"
-
-	"gopkg.in/src-d/go-git.v4"
-	"gopkg.in/src-d/go-git.v4/plumbing/object"
 
 	"github.com/WhoMeNope/gimini/internal"
 )
 
-func main() {
-	// Open repo (init if does not exist)
-	repo, err := internal.OpenOrInit()
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
+// command runs a subcommand with the arguments following its name.
+type command func(repo *internal.Repository, args []string) error
 
-	}
-	w, err := internal.GetWorktree(repo)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
+var commands = map[string]command{
+	"add":     add,
+	"show":    show,
+	"restore": restore,
+	"get":     get,
+	"drop":    drop,
+	"prune":   prune,
+	"gc":      gc,
+	"verify":  verify,
+	"check":   check,
+	"watch":   watch,
+	"tag":     tag,
+	"find":    find,
+	"grep":    grep,
+	"du":      du,
 
-	// Add dir
-	hash, err := w.Add(os.Args[1])
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	fmt.Println(hash)
+	"run-scheduled": runScheduled,
+}
 
-	// Commit
-	hash, err = w.Commit("Commit message", &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  "gimini",
-			Email: "gimini@acme.com",
-			When:  time.Now(),
-		},
-	})
-	if err != nil {
-		fmt.Println(err)
-		return
+// errPartial is returned by commands which snapshotted only some of the
+// paths, the others being listed in the report.
+var errPartial = errors.New("partial snapshot, some paths could not be read")
+
+// errDrift is returned by check when the system differs from the snapshot.
+var errDrift = errors.New("the system differs from the snapshot")
+
+// exitCodes are the exit codes of the errors telling the outcome of a
+// command rather than a failure, other errors exit with 1.
+var exitCodes = map[error]int{
+	errPartial: 3,
+	errDrift:   4,
+}
+
+const usage = `usage: gimini [add] [-m <message>] [-allow-empty] [-trigger <trigger>] <path>
+       gimini show <commit> <path>
+       gimini restore <commit> [path...]
+       gimini get [-commit <commit>] <path>...
+       gimini drop [-commit <commit>] <path>...
+       gimini prune [-n] [-keep-hourly <n>] [-keep-daily <n>] [-keep-weekly <n>]
+                    [-keep-monthly <n>] [-keep-yearly <n>]
+       gimini gc [-n]
+       gimini verify [-sample <percent>]
+       gimini check [-json] <commit> [path...]
+       gimini watch [-quiet <duration>] [-max-interval <duration>]
+       gimini run-scheduled [-daemon]
+       gimini tag [-m <message>] <name> [<commit>]
+       gimini tag -d <name>
+       gimini tag
+       gimini find [-max-commits <n>] <glob> [path...]
+       gimini grep [-i] [-binary] [-max-commits <n>] <pattern> [path...]
+       gimini du [-depth <n>] [<commit>]
+       gimini du -since <date> [-until <date>] [-depth <n>] [-top <n>]`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
 	}
-	fmt.Println(hash)
 
-	// Get commit
-	commit, err := object.GetCommit(w.Repo().Storer, hash)
+	// Open repo (init if does not exist)
+	repo, err := internal.OpenOrInit()
 	if err != nil {
 		fmt.Println(err)
-		return
+		os.Exit(1)
 	}
-	fmt.Println(commit)
 
-	// Get tree
-	tree, err := object.GetTree(w.Repo().Storer, commit.TreeHash)
-	if err != nil {
-		fmt.Println(err)
-		return
+	// Without a known subcommand the arguments are the paths to add
+	cmd, args := add, os.Args[1:]
+	if c, ok := commands[os.Args[1]]; ok {
+		cmd, args = c, os.Args[2:]
 	}
-	fmt.Println(tree)
 
-	// Print status
-	status, err := w.Status()
-	if err != nil {
+	if err := cmd(repo, args); err != nil {
+		if code, ok := exitCodes[err]; ok {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(code)
+		}
+
 		fmt.Println(err)
-		return
+		os.Exit(1)
 	}
-	fmt.Println(status)
 }